@@ -21,6 +21,15 @@ InsulinInjections: %s
 Carbs: %.1f
 `
 
+const formatCreateGlucose = `Created.
+
+ID: %s
+Date: %s
+Type: %s
+Device: %s
+Value: %.0f mg/dL (%.1f mmol/L)
+`
+
 func newCreateCommand(ctx context.Context) *cobra.Command {
 
 	cmd := &cobra.Command{
@@ -34,6 +43,7 @@ func newCreateCommand(ctx context.Context) *cobra.Command {
 
 	cmd.AddCommand(
 		newCreateTreatment(ctx),
+		newCreateGlucose(ctx),
 	)
 
 	return cmd
@@ -67,7 +77,12 @@ func newCreateTreatment(ctx context.Context) *cobra.Command {
 			t.Carbs = carbs
 			t.Insulin = insulin
 
-			insType, err := nightscout.ParseInsulinType(insulinType)
+			catalog, err := nightscout.NewInsulinCatalog(settings.Transform().Insulins)
+			if err != nil {
+				return err
+			}
+
+			insType, err := catalog.ParseInsulinType(insulinType)
 			if err != nil {
 				return err
 			}
@@ -116,7 +131,7 @@ func newCreateTreatment(ctx context.Context) *cobra.Command {
 		},
 	}
 	fs := cmd.Flags()
-	fs.StringVar(&insulinType, "insulin-type", nightscout.Fiasp.String(), "insulin type")
+	fs.StringVar(&insulinType, "insulin-type", "Fiasp", "insulin type (name or alias from transform.insulins config)")
 	fs.StringVar(&enteredBy, "entered-by", "nsexport", "entered by")
 	fs.StringVar(&treatmentType, "treatment-type", "", "treatment type")
 	fs.Float64Var(&insulin, "insulin", 0, "insulin units")
@@ -125,3 +140,95 @@ func newCreateTreatment(ctx context.Context) *cobra.Command {
 
 	return cmd
 }
+
+func newCreateGlucose(ctx context.Context) *cobra.Command {
+
+	var (
+		value      float64
+		kind       string
+		direction  string
+		createTime string
+		device     string
+	)
+
+	cmd := &cobra.Command{
+		Use:           "glucose",
+		Short:         "create glucose entry (e.g. fingerstick reading)",
+		PreRun:        preRun(),
+		PostRun:       postRun(),
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+
+			if value <= 0 {
+				return errors.New("nothing to create")
+			}
+
+			ts := time.Now()
+			if len(createTime) > 0 {
+				var err error
+				ts, err = time.Parse(time.RFC3339, createTime)
+				if err != nil {
+					return err
+				}
+			}
+
+			date := nightscout.NSTime(ts)
+			e := &nightscout.GlucoseEntry{
+				Type:       kind,
+				Device:     device,
+				Date:       &date,
+				DateString: ts.UTC(),
+			}
+
+			switch kind {
+			case nightscout.Sgv:
+				e.Sgv = nightscout.SVG(value)
+				e.Direction = direction
+			case nightscout.Mbg:
+				e.Mbg = nightscout.SVG(value)
+			default:
+				return errors.Errorf("unsupported glucose entry type %q (sgv or mbg)", kind)
+			}
+
+			ns, err := getNightscoutClient(ctx)
+			if err != nil {
+				return err
+			}
+
+			created, err := ns.Glucose().Create(ctx, nightscout.GlucoseEntries{e})
+			if err != nil {
+				return err
+			}
+
+			created.Visit(func(e *nightscout.GlucoseEntry, err error) error {
+
+				v := e.Sgv
+				if e.Type == nightscout.Mbg {
+					v = e.Mbg
+				}
+
+				fmt.Printf(formatCreateGlucose,
+					e.ID,
+					e.Date.Time().Local().String(),
+					e.Type,
+					e.Device,
+					v.Float64(),
+					v.MMol(),
+				)
+
+				return nil
+			})
+
+			return nil
+		},
+	}
+	fs := cmd.Flags()
+	fs.Float64Var(&value, "value", 0, "glucose value (mg/dL)")
+	fs.StringVar(&kind, "type", nightscout.Mbg, "entry type: mbg (fingerstick) or sgv (sensor)")
+	fs.StringVar(&direction, "direction", "NONE", "trend direction for sgv entry (e.g. Flat, SingleUp)")
+	fs.StringVar(&device, "device", "nsexport", "device")
+	fs.StringVar(&createTime, "ts", "", "entry timestamp in RFC3339 (default - current time)")
+
+	return cmd
+}
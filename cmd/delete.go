@@ -3,6 +3,9 @@ package cmd
 import (
 	"context"
 
+	"github.com/blutz1982/go-nsexporter-libreview/pkg/nightscout"
+	"github.com/pkg/errors"
+
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
 )
@@ -19,6 +22,7 @@ func newDeleteCommand(ctx context.Context) *cobra.Command {
 
 	cmd.AddCommand(
 		newDeleteTreatment(ctx),
+		newDeleteGlucose(ctx),
 	)
 
 	return cmd
@@ -58,3 +62,98 @@ func newDeleteTreatment(ctx context.Context) *cobra.Command {
 
 	return cmd
 }
+
+func newDeleteGlucose(ctx context.Context) *cobra.Command {
+
+	var (
+		kind   string
+		dryRun bool
+	)
+
+	cmd := &cobra.Command{
+		Use:           "glucose [ID ...]",
+		Short:         "delete glucose entries by ID or by date range",
+		PreRun:        preRun(),
+		PostRun:       postRun(),
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+
+			if len(args) > 0 && settings.HasDateRange() {
+				return errors.New("use entry IDs or a date range, not both")
+			}
+
+			ns, err := getNightscoutClient(ctx)
+			if err != nil {
+				return err
+			}
+
+			if len(args) > 0 {
+				for i := 0; i < len(args); i++ {
+					if dryRun {
+						log.Info().Str("id", args[i]).Msg("Skip (dry-run)")
+						continue
+					}
+
+					err = ns.Glucose().Delete(ctx, args[i])
+					if err != nil {
+						return err
+					}
+
+					log.Info().Str("id", args[i]).Msg("OK")
+				}
+				return nil
+			}
+
+			// the default range (today) is too wide to delete implicitly
+			if !settings.HasDateRange() {
+				return errors.New("entry IDs or --date-from/--date-offset are required")
+			}
+
+			dateFrom, dateTo, err := settings.DateRange()
+			if err != nil {
+				return err
+			}
+
+			opts := nightscout.ListOptions{
+				Kind:     kind,
+				DateFrom: dateFrom,
+				DateTo:   dateTo,
+				Count:    settings.NightscoutMaxEnties(),
+				PageSize: settings.NightscoutPageSize(),
+			}
+
+			entries, err := ns.Glucose().List(ctx, opts)
+			if err != nil {
+				return err
+			}
+
+			log.Info().
+				Str("type", kind).
+				Time("fromDate", opts.DateFrom).
+				Time("toDate", opts.DateTo).
+				Int("count", entries.Len()).
+				Bool("dry-run", dryRun).
+				Msg("Entries to delete")
+
+			if dryRun || entries.Len() == 0 {
+				return nil
+			}
+
+			if err := ns.Glucose().DeleteMatching(ctx, opts); err != nil {
+				return err
+			}
+
+			log.Info().Msg("OK")
+
+			return nil
+		},
+	}
+
+	fs := cmd.Flags()
+	settings.AddListFlags(fs)
+	fs.StringVar(&kind, "type", nightscout.Sgv, "entry type (sgv, mbg)")
+	fs.BoolVar(&dryRun, "dry-run", false, "only show what would be deleted")
+
+	return cmd
+}
@@ -61,6 +61,7 @@ func newGraphommand(ctx context.Context) *cobra.Command {
 				DateFrom: dateFrom,
 				DateTo:   dateTo,
 				Count:    settings.NightscoutMaxEnties(),
+				PageSize: settings.NightscoutPageSize(),
 			})
 			if err != nil {
 				return err
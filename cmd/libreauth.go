@@ -2,13 +2,33 @@ package cmd
 
 import (
 	"context"
+	"os"
+	"time"
 
 	"github.com/blutz1982/go-nsexporter-libreview/pkg/libreview"
+	"github.com/blutz1982/go-nsexporter-libreview/pkg/printer"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 )
 
-func newLibreAuth(_ context.Context) *cobra.Command {
+type libreAuthInfo struct {
+	AccountID  string    `json:"accountId" yaml:"accountId"`
+	UserName   string    `json:"userName" yaml:"userName"`
+	FirstName  string    `json:"firstName" yaml:"firstName"`
+	LastName   string    `json:"lastName" yaml:"lastName"`
+	Email      string    `json:"email" yaml:"email"`
+	Country    string    `json:"country" yaml:"country"`
+	CreatedAt  time.Time `json:"createdAt" yaml:"createdAt"`
+	Age        string    `json:"age" yaml:"age"`
+	TokenCache string    `json:"tokenCache,omitempty" yaml:"tokenCache,omitempty"`
+}
+
+func newLibreAuth(ctx context.Context) *cobra.Command {
+
+	var (
+		tokenCache string
+		cached     bool
+	)
 
 	cmd := &cobra.Command{
 		Use:           "libreauth",
@@ -19,22 +39,56 @@ func newLibreAuth(_ context.Context) *cobra.Command {
 		SilenceErrors: true,
 		RunE: func(cmd *cobra.Command, args []string) error {
 
-			if err := settings.LoadConfig(); err != nil {
-				return errors.Wrap(err, "cant load config")
-			}
+			var session *libreview.Session
 
-			lv, err := libreview.NewWithConfig(settings.Libreview())
-			if err != nil {
-				return err
-			}
+			if cached {
+				if len(tokenCache) == 0 {
+					return errors.New("--token-cache is required with --cached")
+				}
 
-			if err := lv.Auth(false); err != nil {
-				return err
+				s, err := libreview.LoadSession(tokenCache)
+				if err != nil {
+					return err
+				}
+				if s == nil {
+					return errors.Errorf("no cached token in %s", tokenCache)
+				}
+				session = s
+
+			} else {
+				if err := settings.LoadConfig(); err != nil {
+					return errors.Wrap(err, "cant load config")
+				}
+
+				lv, err := libreview.NewWithConfig(settings.Libreview(), libreviewClientOpts(libreview.WithSessionCache(tokenCache))...)
+				if err != nil {
+					return err
+				}
+
+				if err := lv.Auth(ctx, false); err != nil {
+					return err
+				}
+				session = lv.Session()
 			}
 
-			return nil
+			return printer.NewPrinter(settings.OutFormat(), os.Stdout).Print(&libreAuthInfo{
+				AccountID:  session.AccountID,
+				UserName:   session.UserName,
+				FirstName:  session.FirstName,
+				LastName:   session.LastName,
+				Email:      session.Email,
+				Country:    session.Country,
+				CreatedAt:  session.CreatedAt.Local(),
+				Age:        session.Age().Round(time.Second).String(),
+				TokenCache: tokenCache,
+			})
 		},
 	}
 
+	fs := cmd.Flags()
+	settings.AddOutputFlags(fs)
+	fs.StringVar(&tokenCache, "token-cache", "", "Path to libreview token cache file (for example ./libreview.token )")
+	fs.BoolVar(&cached, "cached", false, "Show cached identity without auth")
+
 	return cmd
 }
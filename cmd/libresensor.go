@@ -8,10 +8,11 @@ import (
 	"github.com/spf13/cobra"
 )
 
-func newLibreNewSensor(_ context.Context) *cobra.Command {
+func newLibreNewSensor(ctx context.Context) *cobra.Command {
 
 	var (
-		setDevice bool
+		setDevice  bool
+		tokenCache string
 	)
 
 	cmd := &cobra.Command{
@@ -30,16 +31,16 @@ func newLibreNewSensor(_ context.Context) *cobra.Command {
 				return errors.Wrap(err, "cant load config")
 			}
 
-			lv, err := libreview.NewWithConfig(settings.Libreview())
+			lv, err := libreview.NewWithConfig(settings.Libreview(), libreviewClientOpts(libreview.WithSessionCache(tokenCache))...)
 			if err != nil {
 				return err
 			}
 
-			if err := lv.Auth(setDevice); err != nil {
+			if err := lv.Login(ctx, setDevice); err != nil {
 				return err
 			}
 
-			return lv.NewSensor(serial)
+			return lv.NewSensor(ctx, serial)
 		},
 	}
 
@@ -48,6 +49,7 @@ func newLibreNewSensor(_ context.Context) *cobra.Command {
 	settings.AddListFlags(fs)
 
 	fs.BoolVar(&setDevice, "set-device", true, "Set this app as main user device. Necessary if the main device was set by another application (e.g. Librelink)")
+	fs.StringVar(&tokenCache, "token-cache", "", "Path to libreview token cache file (for example ./libreview.token )")
 
 	return cmd
 }
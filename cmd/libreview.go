@@ -2,33 +2,58 @@ package cmd
 
 import (
 	"context"
-	"math/rand"
 	"os"
+	"slices"
 	"time"
 
 	"github.com/blutz1982/go-nsexporter-libreview/pkg/libreview"
 	"github.com/blutz1982/go-nsexporter-libreview/pkg/nightscout"
+	"github.com/blutz1982/go-nsexporter-libreview/pkg/scansim"
+	"github.com/blutz1982/go-nsexporter-libreview/pkg/state"
 	"github.com/blutz1982/go-nsexporter-libreview/pkg/transform"
+	"github.com/pkg/errors"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
 )
 
-func newLibreCommand(ctx context.Context) *cobra.Command {
+const (
+	// interval of readings filled in glucose history gaps
+	interpolationStep = 5 * time.Minute
+	// sensor treatments within the window are the same session (e.g. Sensor Change and Sensor Start)
+	sensorSessionWindow = time.Hour
 
-	const (
-		frequencyDeflectionPercent int = 30
-	)
+	// Nightscout API v3 collections of history cursors
+	historyEntries    = "entries"
+	historyTreatments = "treatments"
+)
 
-	var (
-		minInterval       string
-		dryRun            bool
-		avgScanFrequency  int
-		setDevice         bool
-		lastTimestampFile string
-		measurements      []string
-		token             string
-		newSensorSerial   string
-	)
+type libreExportOptions struct {
+	minInterval       string
+	historyInterval   time.Duration
+	historyAggregate  string
+	dryRun            bool
+	avgScanFrequency  int
+	setDevice         bool
+	lastTimestampFile string
+	stateFile         string
+	measurements      []string
+	token             string
+	tokenCache        string
+	newSensorSerial   string
+	watch             bool
+	interval          time.Duration
+	listen            bool
+	debounce          time.Duration
+	sensorProfile     string
+	scanStrategy      string
+	scanSeed          int64
+	gapThreshold      time.Duration
+	fillGaps          time.Duration
+}
+
+func newLibreCommand(ctx context.Context) *cobra.Command {
+
+	opts := new(libreExportOptions)
 
 	cmd := &cobra.Command{
 		Use:           "libreview",
@@ -39,272 +64,1104 @@ func newLibreCommand(ctx context.Context) *cobra.Command {
 		SilenceErrors: true,
 		RunE: func(cmd *cobra.Command, args []string) error {
 
-			dateFrom, dateTo, err := settings.DateRange()
+			ns, err := getNightscoutClient(ctx)
 			if err != nil {
 				return err
 			}
 
-			ns, err := getNightscoutClient(ctx)
+			exporter, err := newLibreExporter(ns, opts)
 			if err != nil {
 				return err
 			}
 
-			nsInsulinEntries, err := ns.Treatments().List(ctx, nightscout.ListOptions{
-				Kind:     nightscout.Insulin,
-				DateFrom: dateFrom,
-				DateTo:   dateTo,
-				Count:    settings.NightscoutMaxEnties(),
-			})
+			if opts.listen && !opts.watch {
+				return errors.New("--listen requires --watch")
+			}
+
+			if opts.watch {
+				var trigger <-chan struct{}
+				if opts.listen {
+					trigger, err = listenNightscout(ctx)
+					if err != nil {
+						return err
+					}
+				}
+				return exporter.Watch(ctx, opts.interval, trigger)
+			}
+
+			dateFrom, dateTo, err := settings.DateRange()
 			if err != nil {
 				return err
 			}
 
-			var lastTS *time.Time
+			return exporter.Export(ctx, dateFrom, dateTo)
 
-			if len(lastTimestampFile) > 0 {
-				lastTS, err = getLastTS(lastTimestampFile)
-				if err != nil {
-					return err
-				}
-			}
+		},
+	}
+
+	fs := cmd.Flags()
+
+	settings.AddListFlags(fs)
+
+	fs.StringVar(&opts.minInterval, "min-interval", "", "Filter: minimum sample interval (duration)")
+	fs.DurationVar(&opts.historyInterval, "history-interval", nightscout.DefaultHistoryInterval, "Scheduled glucose grid interval. The grid is anchored at the sensor start")
+	fs.StringVar(&opts.historyAggregate, "history-aggregate", nightscout.AggregateMean, "Aggregation of readings in a grid interval: mean, median or nearest")
+	fs.IntVar(&opts.avgScanFrequency, "scan-frequency", 90, "Average scan frequency (minutes). e.g. scan internal min=avg-30%, max=avg+30%")
+	fs.DurationVar(&opts.gapThreshold, "gap-threshold", 20*time.Minute, "Glucose history gaps longer than this are reported")
+	fs.DurationVar(&opts.fillGaps, "fill-gaps", 0, "Fill glucose history gaps up to this duration by linear interpolation (e.g. 45m). 0 disables")
+	fs.StringVar(&opts.scanStrategy, "scan-strategy", scansim.StrategyUniform, "Simulated scans: uniform, daytime (fewer scans at night) or trend (scan at every trend change)")
+	fs.Int64Var(&opts.scanSeed, "scan-seed", 0, "Seed of simulated scans, mixed with the date. The same seed gives the same scans")
+	fs.BoolVar(&opts.dryRun, "dry-run", false, "Do not post measurement to LibreView")
+	fs.BoolVar(&opts.setDevice, "set-device", true, "Set this app as main user device. Necessary if the main device was set by another application (e.g. Librelink)")
+	fs.StringVar(&opts.lastTimestampFile, "last-ts-file", "", "Path to last timestamp file (for example ./last.ts )")
+	fs.StringVar(&opts.stateFile, "state-file", "", "Path to sync state file (for example ./state.json )")
+	fs.StringSliceVar(&opts.measurements, "measurements", libreview.DefaultMeasurements, "measurements to upload")
+	fs.StringVar(&opts.token, "token", "", "use existing libreview token (beta)")
+	fs.StringVar(&opts.tokenCache, "token-cache", "", "Path to libreview token cache file (for example ./libreview.token )")
+	fs.StringVar(&opts.newSensorSerial, "install-new-sensor-sn", "", "New sensor serial number. Overrides the serial from Nightscout Sensor Start treatment notes")
+	fs.BoolVar(&opts.watch, "watch", false, "Keep running and export on schedule (see --interval). Use with --date-offset")
+	fs.DurationVar(&opts.interval, "interval", 15*time.Minute, "Export interval in --watch mode")
+	fs.BoolVar(&opts.listen, "listen", false, "Also export on Nightscout real-time updates (new glucose entries or treatments) in --watch mode")
+	fs.StringVar(&opts.sensorProfile, "sensor-profile", "", "Sensor profile for sensor start entries (see libreview.sensors config). libreview.importConfig.sensorProfile if not set")
+	fs.DurationVar(&opts.debounce, "debounce", 30*time.Second, "Updates received within this time after the first one are exported together (with --listen)")
+
+	err := fs.MarkHidden("token")
+	if err != nil {
+		panic(err)
+	}
+
+	err = fs.MarkDeprecated("last-ts-file", "use --state-file instead")
+	if err != nil {
+		panic(err)
+	}
+
+	err = fs.MarkDeprecated("min-interval", "use --history-interval instead")
+	if err != nil {
+		panic(err)
+	}
+
+	return cmd
+}
+
+// libreExporter runs the nightscout -> libreview export pipeline.
+// Clients are kept between runs, so in watch mode the nightscout connection
+// and the libreview token are reused for every cycle.
+type libreExporter struct {
+	opts   *libreExportOptions
+	ns     nightscout.Client
+	lv     libreview.Client
+	state  *state.State
+	ketone *transform.KetoneRule
+	sensor *libreview.SensorProfile
+	// insulins classifies insulin injections
+	insulins *nightscout.InsulinCatalog
+	food     *transform.FoodTypeRule
+	scans    *scansim.Simulator
+	// history is srvModified of the last document of each collection received in this cycle,
+	// the history cursors are moved after upload
+	history map[string]time.Time
+}
 
-			if lastTS != nil {
-				nsInsulinEntries = nsInsulinEntries.Filter(nightscout.TreatmentOnlyAfter(lastTS.UTC().Add(time.Minute)))
+func newLibreExporter(ns nightscout.Client, opts *libreExportOptions) (*libreExporter, error) {
+
+	// legacy flag
+	if len(opts.minInterval) > 0 {
+		d, err := time.ParseDuration(opts.minInterval)
+		if err != nil {
+			return nil, err
+		}
+		opts.historyInterval = d
+	}
+
+	if !slices.Contains(nightscout.Aggregates, opts.historyAggregate) {
+		return nil, errors.Errorf("unknown --history-aggregate %q, expected one of %v", opts.historyAggregate, nightscout.Aggregates)
+	}
+
+	st, err := state.Load(opts.stateFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "cant load state")
+	}
+
+	// migrate from legacy timestamp file
+	if st.Empty() && len(opts.lastTimestampFile) > 0 {
+		lastTS, err := getLastTS(opts.lastTimestampFile)
+		if err != nil {
+			return nil, err
+		}
+		if lastTS != nil {
+			for _, m := range []string{libreview.ScheduledGlucose, libreview.UnscheduledGlucose, libreview.Insulin, libreview.Food} {
+				st.SetCursor(m, *lastTS)
 			}
+		}
+	}
 
-			log.Info().
-				Int("count", nsInsulinEntries.Len()).
-				Time("fromDate", dateFrom).
-				Time("toDate", dateTo).
-				Msg("Get insulin entries from Nightscout")
+	ketone, err := transform.NewKetoneRule(settings.Transform().Ketone)
+	if err != nil {
+		return nil, err
+	}
 
-			var libreInsulinEntries libreview.InsulinEntries
+	insulins, err := nightscout.NewInsulinCatalog(settings.Transform().Insulins)
+	if err != nil {
+		return nil, err
+	}
 
-			nsInsulinEntries.Visit(func(t *nightscout.Treatment, _ error) error {
-				libreInsulinEntries.Append(transform.NSToLibreInsulinEntry(t))
+	food, err := transform.NewFoodTypeRule(settings.Transform().Food)
+	if err != nil {
+		return nil, err
+	}
 
-				log.Debug().
-					Time("ts", t.CreatedAt.Local()).
-					Float64("insulin", t.Insulin).
-					Str("type", transform.LongActingInsulinMap[t.InsulinInjections.IsLongActing()]).
-					Msg("Insulin entry")
+	scans, err := scansim.New(opts.scanStrategy,
+		scansim.WithAvgInterval(time.Duration(opts.avgScanFrequency)*time.Minute),
+		scansim.WithSeed(opts.scanSeed),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &libreExporter{
+		opts:     opts,
+		ns:       ns,
+		state:    st,
+		ketone:   ketone,
+		insulins: insulins,
+		food:     food,
+		scans:    scans,
+	}
+
+	if slices.Contains(e.exportedMeasurements(), libreview.SensorStart) {
+		// announced sessions are kept in state, without state file the sensor is announced on every run
+		if len(opts.stateFile) == 0 {
+			return nil, errors.New("sensorStart measurement requires --state-file")
+		}
+
+		e.sensor, err = settings.Libreview().SensorProfile(opts.sensorProfile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return e, nil
+}
+
+// Watch runs Export every interval and after each trigger until ctx is done.
+// Triggers received within --debounce after the first one are batched into one export.
+// The date range is recalculated before each cycle, so --date-offset works as a sliding window.
+// Errors of a single cycle are logged and do not stop the loop.
+func (e *libreExporter) Watch(ctx context.Context, interval time.Duration, trigger <-chan struct{}) error {
+
+	if interval <= 0 {
+		return errors.Errorf("bad interval %s", interval)
+	}
+
+	log.Info().
+		Dur("interval", interval).
+		Bool("listen", trigger != nil).
+		Msg("Watch mode started")
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var (
+		debounce  *time.Timer
+		debounceC <-chan time.Time
+	)
+
+	for {
+		if err := e.runOnce(ctx); err != nil {
+			log.Error().
+				Err(err).
+				Msg("Export cycle failed")
+		}
+
+		if debounce != nil {
+			debounce.Stop()
+			debounce, debounceC = nil, nil
+		}
+
+	wait:
+		for {
+			select {
+			case <-ctx.Done():
+				log.Info().Msg("Watch mode stopped")
 				return nil
-			})
-
-			nsCarbsEntries, err := ns.Treatments().List(ctx, nightscout.ListOptions{
-				Kind:     nightscout.Carbs,
-				DateFrom: dateFrom,
-				DateTo:   dateTo,
-				Count:    settings.NightscoutMaxEnties(),
-			})
-			if err != nil {
-				return err
+			case <-ticker.C:
+				break wait
+			case <-trigger:
+				if debounce == nil {
+					debounce = time.NewTimer(e.opts.debounce)
+					debounceC = debounce.C
+				}
+			case <-debounceC:
+				log.Info().Msg("Nightscout update received")
+				break wait
 			}
+		}
+	}
+}
 
-			if lastTS != nil {
-				nsCarbsEntries = nsCarbsEntries.Filter(nightscout.TreatmentOnlyAfter(lastTS.UTC().Add(time.Minute)))
-			}
+// listenNightscout starts Nightscout listener. A value is sent to the returned channel on each update
+// with new glucose entries or treatments
+func listenNightscout(ctx context.Context) (<-chan struct{}, error) {
+
+	listener, err := getNightscoutListener()
+	if err != nil {
+		return nil, err
+	}
+
+	return nightscoutTrigger(ctx, listener), nil
+}
+
+func nightscoutTrigger(ctx context.Context, listener *nightscout.Listener) <-chan struct{} {
+
+	trigger := make(chan struct{}, 1)
+
+	go listener.Listen(ctx, func(u *nightscout.DataUpdate) {
+		// the first update after connect contains all recent data
+		if !u.Delta || !(u.HasGlucose() || u.HasTreatments()) {
+			return
+		}
+
+		log.Debug().
+			Int("sgvs", len(u.Sgvs)).
+			Int("treatments", len(u.Treatments)).
+			Msg("Nightscout dataUpdate")
+
+		select {
+		case trigger <- struct{}{}:
+		default:
+		}
+	})
+
+	return trigger
+}
+
+func (e *libreExporter) runOnce(ctx context.Context) error {
+	dateFrom, dateTo, err := settings.DateRange()
+	if err != nil {
+		return err
+	}
+
+	return e.Export(ctx, dateFrom, dateTo)
+}
+
+// libreview returns authorized libreview client. Auth is done only once per exporter.
+func (e *libreExporter) libreview(ctx context.Context) (libreview.Client, error) {
+	if e.lv != nil {
+		return e.lv, nil
+	}
+
+	lv, err := libreview.NewWithConfig(settings.Libreview(), libreviewClientOpts(
+		libreview.WithLedger(exportLedger{e.state}),
+		libreview.WithSessionCache(e.opts.tokenCache),
+	)...)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(e.opts.token) == 0 {
+		if err := lv.Login(ctx, e.opts.setDevice); err != nil {
+			return nil, err
+		}
+	} else {
+		lv.SetToken(e.opts.token)
+	}
+
+	if session := lv.Session(); session != nil {
+		log.Debug().
+			Str("accountId", session.AccountID).
+			Dur("age", session.Age()).
+			Msg("use libreview session")
+	}
+
+	e.lv = lv
+
+	return lv, nil
+}
+
+func (e *libreExporter) Export(ctx context.Context, dateFrom, dateTo time.Time) error {
+
+	ns := e.ns
+
+	dateFrom, changed, err := e.nsHistory(ctx, dateFrom)
+	if err != nil {
+		return err
+	}
+
+	if !changed {
+		log.Info().
+			Msg("Nothing to post: no changes in Nightscout since the last sync")
+		if e.opts.dryRun {
+			return nil
+		}
+		// skip own and deleted documents next time
+		e.saveHistory()
+		return errors.Wrap(e.state.Save(), "cant save state")
+	}
+
+	// one query for all treatments: a Meal Bolus has both insulin and carbs
+	nsTreatments, err := ns.Treatments().List(ctx, nightscout.ListOptions{
+		DateFrom: dateFrom,
+		DateTo:   dateTo,
+		Count:    settings.NightscoutMaxEnties(),
+		PageSize: settings.NightscoutPageSize(),
+	})
+	if err != nil {
+		return err
+	}
 
-			log.Info().
-				Int("count", nsCarbsEntries.Len()).
-				Time("fromDate", dateFrom).
-				Time("toDate", dateTo).
-				Msg("Get food entries from Nightscout")
+	// entries imported from LibreView (nightscout import-from-libreview) are not uploaded back
+	nsTreatments = nsTreatments.Filter(nightscout.NotEnteredBy(transform.NSEnteredBy))
 
-			var libreFoodEntries libreview.FoodEntries
+	log.Info().
+		Int("count", nsTreatments.Len()).
+		Time("fromDate", dateFrom).
+		Time("toDate", dateTo).
+		Msg("Get treatments from Nightscout")
+
+	libreInsulinEntries, libreFoodEntries := e.insulinAndFoodEntries(nsTreatments)
+
+	libreBloodGlucoseEntries, err := e.bloodGlucoseEntries(ctx, nsTreatments, dateFrom, dateTo)
+	if err != nil {
+		return err
+	}
+
+	libreKetoneEntries := e.ketoneEntries(nsTreatments)
+	libreExerciseEntries := e.exerciseEntries(nsTreatments)
+	libreNoteEntries := e.noteEntries(nsTreatments)
+
+	nsGlucoseEntries, err := ns.Glucose().List(ctx, nightscout.ListOptions{
+		DateFrom: dateFrom,
+		DateTo:   dateTo,
+		Count:    settings.NightscoutMaxEnties(),
+		PageSize: settings.NightscoutPageSize(),
+		Kind:     nightscout.Sgv,
+	})
+	if err != nil {
+		return err
+	}
+
+	nsGlucoseEntries = nsGlucoseEntries.Filter(nightscout.NotFromDevice(transform.NSEnteredBy))
+
+	libreAlarmEntries := e.alarmEntries(nsGlucoseEntries)
+
+	// the cursor is the last exported grid point, its bucket ends one history interval later.
+	// The last reading of the exported buckets is the left edge of the gap before the first new reading,
+	// it is dropped after gaps are found and filled
+	var exportedUntil *time.Time
+	if cursor := e.state.Cursor(libreview.ScheduledGlucose); cursor != nil {
+		until := cursor.Add(e.opts.historyInterval)
+		exportedUntil = &until
+
+		edge := nsGlucoseEntries.Filter(func(g *nightscout.GlucoseEntry) bool {
+			return g.Date.Time().Before(until)
+		}).Latest()
+
+		nsGlucoseEntries = nsGlucoseEntries.Filter(nightscout.NotBefore(until))
+		if edge != nil && nsGlucoseEntries.Len() > 0 {
+			nsGlucoseEntries.Append(edge)
+		}
+	}
+
+	gaps := nsGlucoseEntries.Gaps(e.opts.gapThreshold)
+
+	interpolated := 0
+	if e.opts.fillGaps > 0 {
+		nsGlucoseEntries, interpolated = nsGlucoseEntries.Interpolate(interpolationStep, e.opts.fillGaps)
+	}
+
+	if exportedUntil != nil {
+		nsGlucoseEntries = nsGlucoseEntries.Filter(nightscout.NotBefore(*exportedUntil))
+	}
+
+	// gaps not filled by interpolation
+	var longGaps []nightscout.Gap
+	for _, gap := range gaps {
+		if gap.Duration() <= e.opts.fillGaps {
+			continue
+		}
+		longGaps = append(longGaps, gap)
+		log.Warn().
+			Time("from", gap.From.Local()).
+			Time("to", gap.To.Local()).
+			Dur("duration", gap.Duration()).
+			Msg("Gap in glucose history")
+	}
+
+	// scans are simulated from readings, not from the grid
+	nsReadings := nsGlucoseEntries.Filter(nightscout.NotInterpolated())
+
+	nsGlucoseEntries, err = nsGlucoseEntries.Resample(nightscout.ResampleOptions{
+		Interval:  e.opts.historyInterval,
+		Anchors:   e.sensorStarts(nsTreatments),
+		Aggregate: e.opts.historyAggregate,
+		Until:     dateTo,
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Info().
+		Int("count", nsGlucoseEntries.Len()).
+		Int("gaps", len(longGaps)).
+		Int("interpolated", interpolated).
+		Time("fromDate", dateFrom).
+		Time("toDate", dateTo).
+		Msg("Get scheduled glucose entries from Nightscout")
+
+	var libreScheduledGlucoseEntries libreview.ScheduledContinuousGlucoseEntries
+	nsGlucoseEntries.Visit(func(e *nightscout.GlucoseEntry, err error) error {
+		libreScheduledGlucoseEntries.Append(transform.NSToLibreScheduledGlucoseEntry(e))
+		log.Debug().
+			Time("ts", e.Date.Time().Local()).
+			Float64("svg", e.Sgv.Float64()).
+			Str("direction", e.Direction).
+			Bool("interpolated", e.Interpolated).
+			Msg("Scheduled Glucose entry")
+		return nil
+	})
+
+	log.Info().
+		Int("count", nsReadings.Len()).
+		Time("fromDate", dateFrom).
+		Time("toDate", dateTo).
+		Msg("Prepare unscheduled glucose entries")
+
+	var (
+		libreUnscheduledGlucoseEntries libreview.UnscheduledContinuousGlucoseEntries
+		// the last exported scan
+		lastScan time.Time
+	)
+
+	unscheduledCursor := e.state.Cursor(libreview.UnscheduledGlucose)
+	if unscheduledCursor != nil {
+		lastScan = *unscheduledCursor
+	}
+
+	for _, scan := range e.scans.Scans(*nsReadings, lastScan) {
+		libreUnscheduledGlucoseEntries.Append(transform.NSToLibreUnscheduledGlucoseEntry(scan.Entry, scan.Jitter))
+	}
+
+	if unscheduledCursor != nil {
+		libreUnscheduledGlucoseEntries = libreUnscheduledGlucoseEntries.Filter(func(e *libreview.UnscheduledContinuousGlucoseEntry) bool {
+			return e.Timestamp.After(*unscheduledCursor)
+		})
+	}
+
+	libreUnscheduledGlucoseEntries.Visit(func(e *libreview.UnscheduledContinuousGlucoseEntry, _ error) error {
+		log.Debug().
+			Time("ts", e.Timestamp).
+			Float64("svg", e.ValueInMgPerDl).
+			Str("direction", e.ExtendedProperties.TrendArrow).
+			Msg("Unscheduled Glucose entry")
+		return nil
+	})
+
+	log.Info().
+		Strs("measurements", e.opts.measurements).
+		Msg("Measurements to export")
+
+	exported := e.exportedMeasurements()
+
+	var sensor *state.SensorSession
+	if slices.Contains(exported, libreview.SensorStart) {
+		sensor = e.sensorSession(nsTreatments)
+	}
+
+	// LibreView needs the serial of the new sensor, the session is announced when the serial is known
+	if sensor != nil && len(sensor.Serial) == 0 {
+		log.Warn().
+			Time("install time", sensor.StartedAt.Local()).
+			Msg("Sensor serial unknown (add it to the treatment notes or use --install-new-sensor-sn), sensor start skipped")
+		sensor = nil
+	}
 
-			nsCarbsEntries.Visit(func(t *nightscout.Treatment, err error) error {
-				libreFoodEntries.Append(transform.NSToLibreFoodEntry(t))
+	var (
+		libreSensorStartEntries libreview.GenericEntries
+		libreSensorStartEntry   *libreview.GenericEntry
+	)
+	if sensor != nil {
+		libreSensorStartEntry = transform.LibreSensorStartEntry(sensor.StartedAt, *e.sensor)
+		libreSensorStartEntries.Append(libreSensorStartEntry)
+	}
+
+	measurementMap := map[string]libreview.MeasuremenModificator{
+		libreview.ScheduledGlucose:   libreview.WithScheduledGlucoseEntries(libreScheduledGlucoseEntries),
+		libreview.UnscheduledGlucose: libreview.WithUnscheduledGlucoseEntries(libreUnscheduledGlucoseEntries),
+		libreview.Insulin:            libreview.WithInsulinEntries(libreInsulinEntries),
+		libreview.Food:               libreview.WithFoodEntries(libreFoodEntries),
+		libreview.SensorStart:        libreview.WithGenericEntries(libreSensorStartEntries),
+		libreview.BloodGlucose:       libreview.WithBloodGlucoseEntries(libreBloodGlucoseEntries),
+		libreview.Ketone:             libreview.WithKetoneEntries(libreKetoneEntries),
+		libreview.Exercise:           libreview.WithGenericEntries(libreExerciseEntries),
+		libreview.Note:               libreview.WithGenericEntries(libreNoteEntries),
+		libreview.Alarm:              libreview.WithGenericEntries(libreAlarmEntries),
+	}
+
+	var modificators []libreview.MeasuremenModificator
+	for _, m := range exported {
+		if modificator, ok := measurementMap[m]; ok {
+			modificators = append(modificators, modificator)
+		}
+	}
+
+	if sensor != nil {
+		log.Info().
+			Str("serial", sensor.Serial).
+			Time("install time", sensor.StartedAt.Local()).
+			Msg("Prepare sensor start generic entry")
+	}
+
+	// every measurement type has its own cursor, the entries are posted even without new glucose entries
+	var pending libreview.MeasurementLog
+	for _, fn := range modificators {
+		fn(&pending)
+	}
+
+	if e.opts.dryRun || pending.Len() == 0 {
+		log.Info().
+			Bool("dry-run", e.opts.dryRun).
+			Int("entries", pending.Len()).
+			Msg("Nothing to post")
+		if e.opts.dryRun {
+			return nil
+		}
+		// keep new grid anchors
+		return errors.Wrap(e.state.Save(), "cant save state")
+	}
+
+	lv, err := e.libreview(ctx)
+	if err != nil {
+		return err
+	}
+
+	resp, err := lv.ImportMeasurements(ctx, modificators...)
+	if errors.Is(err, libreview.ErrNothingToImport) {
+		log.Info().
+			Msg("Nothing to post: all entries already uploaded")
+		e.saveHistory()
+		return errors.Wrap(e.state.Save(), "cant save state")
+	}
+	if err != nil {
+		// token may be expired, auth again on next run
+		e.lv = nil
+		return err
+	}
+
+	if sensor != nil {
+		e.announceSensor(ctx, lv, *sensor, libreSensorStartEntry)
+	}
+
+	log.Info().
+		Int("scheduledGlucoseEntries", resp.Result.MeasurementCounts.ScheduledGlucoseCount).
+		Int("unscheduledGlucoseEntries", resp.Result.MeasurementCounts.UnScheduledGlucoseCount).
+		Int("insulin", resp.Result.MeasurementCounts.InsulinCount).
+		Int("food", resp.Result.MeasurementCounts.FoodCount).
+		Int("bloodGlucose", resp.Result.MeasurementCounts.BloodGlucoseCount).
+		Int("ketone", resp.Result.MeasurementCounts.KetoneCount).
+		Int("generic", resp.Result.MeasurementCounts.GenericCount).
+		Int("gaps", len(longGaps)).
+		Int("interpolated", interpolated).
+		Msg("Export measurements success")
+
+	return e.saveState(lv, resp, exported)
+
+}
+
+// exportedMeasurements returns --measurements known to the exporter without duplicates
+func (e *libreExporter) exportedMeasurements() (result []string) {
+	for _, m := range e.opts.measurements {
+		// generic is the legacy name of sensorStart
+		if m == libreview.Generic {
+			m = libreview.SensorStart
+		}
+		if slices.Contains(libreview.AllMeasurements, m) && !slices.Contains(result, m) {
+			result = append(result, m)
+		}
+	}
+	return
+}
+
+// nsHistory narrows the export window with Nightscout API v3 history and reports whether anything changed
+// since the last sync. Only documents modified after the history cursors are requested (after dateFrom on the first run).
+// The window starts at the earliest changed document or the oldest measurement cursor, one history interval earlier
+// to complete the grid bucket. The window is not changed for API v1
+func (e *libreExporter) nsHistory(ctx context.Context, dateFrom time.Time) (time.Time, bool, error) {
+
+	glucoseHistory, ok := e.ns.Glucose().(nightscout.GlucoseHistoryInterface)
+	if !ok {
+		return dateFrom, true, nil
+	}
+
+	treatmentsHistory, ok := e.ns.Treatments().(nightscout.TreatmentsHistoryInterface)
+	if !ok {
+		return dateFrom, true, nil
+	}
+
+	historyOptions := func(collection string) nightscout.HistoryOptions {
+		opts := nightscout.HistoryOptions{
+			Since:    dateFrom,
+			Count:    settings.NightscoutMaxEnties(),
+			PageSize: settings.NightscoutPageSize(),
+		}
+		if cursor := e.state.HistoryCursor(collection); cursor != nil {
+			opts.Since = *cursor
+		}
+		return opts
+	}
+
+	var (
+		changed  int
+		earliest time.Time
+	)
+
+	change := func(ts time.Time) {
+		changed++
+		if earliest.IsZero() || ts.Before(earliest) {
+			earliest = ts
+		}
+	}
+
+	entriesModified, err := glucoseHistory.History(ctx, historyOptions(historyEntries), func(g *nightscout.GlucoseEntry, _ error) error {
+		if !g.Deleted() && g.Date != nil && g.Device != transform.NSEnteredBy {
+			change(g.Date.Time())
+		}
+		return nil
+	})
+	if err != nil {
+		return dateFrom, false, err
+	}
+
+	treatmentsModified, err := treatmentsHistory.History(ctx, historyOptions(historyTreatments), func(t *nightscout.Treatment, _ error) error {
+		if !t.Deleted() && t.EnteredBy != transform.NSEnteredBy {
+			change(t.CreatedAt)
+		}
+		return nil
+	})
+	if err != nil {
+		return dateFrom, false, err
+	}
+
+	e.history = map[string]time.Time{
+		historyEntries:    entriesModified,
+		historyTreatments: treatmentsModified,
+	}
+
+	log.Info().
+		Int("changed", changed).
+		Time("entriesModified", entriesModified).
+		Time("treatmentsModified", treatmentsModified).
+		Msg("Get history from Nightscout")
+
+	if changed == 0 {
+		return dateFrom, false, nil
+	}
+
+	// the first sync
+	if e.state.HistoryCursor(historyEntries) == nil || e.state.HistoryCursor(historyTreatments) == nil {
+		return dateFrom, true, nil
+	}
+
+	// entries after the cursors are not uploaded yet. Measurements without cursor had no entries at the last sync
+	from := earliest
+	for _, m := range e.exportedMeasurements() {
+		if cursor := e.state.Cursor(m); cursor != nil && cursor.Before(from) {
+			from = *cursor
+		}
+	}
+
+	from = from.Add(-e.opts.historyInterval)
+	if from.Before(dateFrom) {
+		return dateFrom, true, nil
+	}
+
+	log.Debug().
+		Time("fromDate", from).
+		Msg("Export window narrowed by Nightscout history")
+
+	return from, true, nil
+}
+
+// saveHistory moves the history cursors after upload
+func (e *libreExporter) saveHistory() {
+	for collection, ts := range e.history {
+		e.state.SetHistoryCursor(collection, ts)
+	}
+	e.history = nil
+}
+
+// sensorStarts returns start times of known sensor sessions as grid anchors. Sensor treatments are recorded
+// in state, so the grid stays anchored after the treatment leaves the export window
+func (e *libreExporter) sensorStarts(nsTreatments *nightscout.Treatments) []time.Time {
+	nsTreatments.Visit(func(t *nightscout.Treatment, _ error) error {
+		// Sensor Change and Sensor Start of one session
+		if transform.IsSensorStart(t) && e.state.AddAnchor(t.CreatedAt, sensorSessionWindow) {
+			log.Debug().
+				Time("ts", t.CreatedAt.Local()).
+				Msg("New glucose grid anchor")
+		}
+		return nil
+	})
+	return e.state.SensorStarts()
+}
+
+// sensorSession returns the latest Sensor Start / Sensor Change session not announced yet or nil.
+// The --install-new-sensor-sn serial overrides the serial from treatment notes.
+// Without sensor treatments the session starts now if the serial is set
+func (e *libreExporter) sensorSession(nsTreatments *nightscout.Treatments) *state.SensorSession {
+
+	var latest *nightscout.Treatment
+	nsTreatments.Visit(func(t *nightscout.Treatment, _ error) error {
+		if transform.IsSensorStart(t) && (latest == nil || t.CreatedAt.After(latest.CreatedAt)) {
+			latest = t
+		}
+		return nil
+	})
+
+	if latest == nil {
+		if len(e.opts.newSensorSerial) == 0 {
+			return nil
+		}
+		if e.state.SerialAnnounced(e.opts.newSensorSerial) {
+			log.Debug().
+				Str("serial", e.opts.newSensorSerial).
+				Msg("Sensor already announced")
+			return nil
+		}
+		log.Warn().
+			Str("serial", e.opts.newSensorSerial).
+			Msg("No sensor start treatment in Nightscout, the current time is used as install time")
+		return &state.SensorSession{
+			StartedAt: time.Now().UTC(),
+			Serial:    e.opts.newSensorSerial,
+		}
+	}
+
+	if e.state.SensorAnnounced(latest.CreatedAt, sensorSessionWindow) {
+		log.Debug().
+			Time("ts", latest.CreatedAt.Local()).
+			Msg("Sensor session already announced")
+		return nil
+	}
+
+	serial := e.opts.newSensorSerial
+	if len(serial) == 0 {
+		serial = transform.SensorSerial(latest)
+	}
+
+	return &state.SensorSession{
+		StartedAt: latest.CreatedAt.UTC(),
+		Serial:    serial,
+	}
+}
+
+// announceSensor sets the new active sensor in LibreView and records the session and its sensorstart entry in state.
+// Nothing is recorded if the announcement failed, so the next run posts the entry and announces the sensor again
+func (e *libreExporter) announceSensor(ctx context.Context, lv libreview.Client, sensor state.SensorSession, entry *libreview.GenericEntry) {
+
+	if err := lv.NewSensor(ctx, sensor.Serial); err != nil {
+		log.Error().
+			Err(err).
+			Msg("Posible new sensor install failed")
+		return
+	}
+
+	// the sensor is announced only once, also in watch mode
+	e.opts.newSensorSerial = ""
+	sensor.AnnouncedAt = time.Now().UTC()
+	e.state.AddSensor(sensor)
+	e.state.AddUploaded(libreview.SensorStart, entry.RecordNumber, entry.Timestamp)
+
+	log.Info().
+		Str("serial", sensor.Serial).
+		Time("install time", sensor.StartedAt.Local()).
+		Msg("New sensor announced")
+}
+
+// exportLedger is the state ledger without sensorstart entries, they are recorded by announceSensor
+type exportLedger struct {
+	*state.State
+}
+
+func (l exportLedger) AddUploaded(measurement string, recordNumber int64, ts time.Time) {
+	if measurement == libreview.SensorStart {
+		return
+	}
+	l.State.AddUploaded(measurement, recordNumber, ts)
+}
+
+// insulinAndFoodEntries classifies each treatment by its content. A treatment with insulin and carbs
+// (e.g. Meal Bolus) gives both insulin and food entries with the same timestamp
+func (e *libreExporter) insulinAndFoodEntries(nsTreatments *nightscout.Treatments) (insulin libreview.InsulinEntries, food libreview.FoodEntries) {
+
+	insulinCursor := e.state.Cursor(libreview.Insulin)
+	foodCursor := e.state.Cursor(libreview.Food)
+
+	nsTreatments.Visit(func(t *nightscout.Treatment, _ error) error {
+
+		if t.Insulin > 0 || len(t.InsulinInjections) > 0 {
+			if insulinCursor == nil || t.CreatedAt.After(*insulinCursor) {
+				if len(t.InsulinInjections) > libreview.MaxInsulinInjections {
+					log.Warn().
+						Str("id", t.ID).
+						Time("ts", t.CreatedAt.Local()).
+						Int("injections", len(t.InsulinInjections)).
+						Int("max", libreview.MaxInsulinInjections).
+						Msg("Too many insulin injections in the treatment, the rest are skipped")
+				}
+				for _, entry := range transform.NSToLibreInsulinEntries(t, e.insulins) {
+					insulin.Append(entry)
+					log.Debug().
+						Str("id", t.ID).
+						Time("ts", t.CreatedAt.Local()).
+						Float64("insulin", entry.Units).
+						Str("type", entry.InsulinType).
+						Msg("Insulin entry")
+				}
+			}
+		}
+
+		if t.Carbs > 0 {
+			if foodCursor == nil || t.CreatedAt.After(*foodCursor) {
+				entry := transform.NSToLibreFoodEntry(t, e.food)
+				food.Append(entry)
 				log.Debug().
+					Str("id", entry.SourceID).
 					Time("ts", t.CreatedAt.Local()).
 					Float64("carbs", t.Carbs).
+					Float64("protein", t.Protein.Float64()).
+					Float64("fat", t.Fat.Float64()).
+					Str("foodType", entry.FoodType).
+					Str("notes", t.Notes).
 					Msg("Food entry")
-				return nil
-			})
-
-			nsGlucoseEntries, err := ns.Glucose().List(ctx, nightscout.ListOptions{
-				DateFrom: dateFrom,
-				DateTo:   dateTo,
-				Count:    settings.NightscoutMaxEnties(),
-				Kind:     nightscout.Sgv,
-			})
-			if err != nil {
-				return err
 			}
+		}
 
-			if lastTS != nil {
-				nsGlucoseEntries = nsGlucoseEntries.Filter(nightscout.OnlyAfter(lastTS.UTC().Add(time.Minute)))
-			}
+		return nil
+	})
 
-			d, err := time.ParseDuration(minInterval)
-			if err != nil {
-				return err
-			}
+	log.Info().
+		Int("insulin", len(insulin)).
+		Int("food", len(food)).
+		Msg("Prepare insulin and food entries")
 
-			nsGlucoseEntries = nsGlucoseEntries.Downsample(nightscout.DownsampleDuration(d))
+	return
+}
 
-			log.Info().
-				Int("count", nsGlucoseEntries.Len()).
-				Time("fromDate", dateFrom).
-				Time("toDate", dateTo).
-				Msg("Get scheduled glucose entries from Nightscout")
+// bloodGlucoseEntries returns fingersticks: mbg entries and treatments with finger glucose (BG Check).
+// A treatment is skipped if there is a mbg entry at the same time
+func (e *libreExporter) bloodGlucoseEntries(ctx context.Context, nsTreatments *nightscout.Treatments, dateFrom, dateTo time.Time) (libreview.BloodGlucoseEntries, error) {
 
-			var libreScheduledGlucoseEntries libreview.ScheduledContinuousGlucoseEntries
-			nsGlucoseEntries.Visit(func(e *nightscout.GlucoseEntry, err error) error {
-				libreScheduledGlucoseEntries.Append(transform.NSToLibreScheduledGlucoseEntry(e))
-				log.Debug().
-					Time("ts", e.Date.Time().Local()).
-					Float64("svg", e.Sgv.Float64()).
-					Str("direction", e.Direction).
-					Msg("Scheduled Glucose entry")
-				return nil
-			})
+	nsMbgEntries, err := e.ns.Glucose().List(ctx, nightscout.ListOptions{
+		Kind:     nightscout.Mbg,
+		DateFrom: dateFrom,
+		DateTo:   dateTo,
+		Count:    settings.NightscoutMaxEnties(),
+		PageSize: settings.NightscoutPageSize(),
+	})
+	if err != nil {
+		return nil, err
+	}
 
-			log.Info().
-				Int("count", nsGlucoseEntries.Len()).
-				Time("fromDate", dateFrom).
-				Time("toDate", dateTo).
-				Msg("Prepare unscheduled glucose entries")
+	nsMbgEntries = nsMbgEntries.Filter(nightscout.NotFromDevice(transform.NSEnteredBy))
 
-			min, max := getRangeSpread(avgScanFrequency, frequencyDeflectionPercent)
+	nsBGChecks := nsTreatments
+	if cursor := e.state.Cursor(libreview.BloodGlucose); cursor != nil {
+		nsMbgEntries = nsMbgEntries.Filter(nightscout.OnlyAfter(*cursor))
+		nsBGChecks = nsBGChecks.Filter(nightscout.TreatmentOnlyAfter(*cursor))
+	}
 
-			var libreUnscheduledGlucoseEntries libreview.UnscheduledContinuousGlucoseEntries
+	var result libreview.BloodGlucoseEntries
 
-			nsGlucoseEntries.Downsample(func() time.Duration {
-				return (time.Minute * time.Duration(rand.Intn(max-min)+min))
+	nsMbgEntries.Visit(func(g *nightscout.GlucoseEntry, _ error) error {
+		result.Append(transform.NSToLibreBloodGlucoseEntry(g))
+		log.Debug().
+			Time("ts", g.Date.Time().Local()).
+			Float64("mbg", g.Mbg.Float64()).
+			Msg("Blood glucose entry")
+		return nil
+	})
 
-			}).Visit(func(e *nightscout.GlucoseEntry, _ error) error {
-				libreUnscheduledGlucoseEntries.Append(transform.NSToLibreUnscheduledGlucoseEntry(e))
-				return nil
-			})
+	nsBGChecks.Visit(func(t *nightscout.Treatment, _ error) error {
+		if !t.IsFingerstick() || nsMbgEntries.Near(t.CreatedAt, time.Minute) {
+			return nil
+		}
+		result.Append(transform.NSTreatmentToLibreBloodGlucoseEntry(t))
+		log.Debug().
+			Time("ts", t.CreatedAt.Local()).
+			Float64("mbg", t.GlucoseMgPerDl().Float64()).
+			Str("eventType", t.EventType).
+			Msg("Blood glucose entry")
+		return nil
+	})
 
-			libreUnscheduledGlucoseEntries.Visit(func(e *libreview.UnscheduledContinuousGlucoseEntry, _ error) error {
-				log.Debug().
-					Time("ts", e.Timestamp).
-					Float64("svg", e.ValueInMgPerDl).
-					Str("direction", e.ExtendedProperties.TrendArrow).
-					Msg("Unscheduled Glucose entry")
-				return nil
-			})
+	log.Info().
+		Int("count", len(result)).
+		Time("fromDate", dateFrom).
+		Time("toDate", dateTo).
+		Msg("Get blood glucose entries from Nightscout")
 
-			log.Info().
-				Strs("measurements", measurements).
-				Msg("Measurements to export")
+	return result, nil
+}
 
-			var libreGenericEntries libreview.GenericEntries
-			lastScan, ok := libreUnscheduledGlucoseEntries.Last()
-			if ok {
-				libreGenericEntries.Append(transform.LibreUnscheduledContinuousGlucoseEntryToSensorStart(lastScan))
-			}
+// ketoneEntries returns treatments recognized as ketone readings (see transform.ketone config)
+func (e *libreExporter) ketoneEntries(nsTreatments *nightscout.Treatments) (result libreview.KetoneEntries) {
 
-			measurementMap := map[string]libreview.MeasuremenModificator{
-				"scheduledContinuousGlucose":   libreview.WithScheduledGlucoseEntries(libreScheduledGlucoseEntries),
-				"unscheduledContinuousGlucose": libreview.WithUnscheduledGlucoseEntries(libreUnscheduledGlucoseEntries),
-				"insulin":                      libreview.WithInsulinEntries(libreInsulinEntries),
-				"food":                         libreview.WithFoodEntries(libreFoodEntries),
-				"generic":                      libreview.WithGenericEntries(libreGenericEntries),
-			}
+	if cursor := e.state.Cursor(libreview.Ketone); cursor != nil {
+		nsTreatments = nsTreatments.Filter(nightscout.TreatmentOnlyAfter(*cursor))
+	}
 
-			var modificators []libreview.MeasuremenModificator
+	nsTreatments.Visit(func(t *nightscout.Treatment, _ error) error {
+		value, ok := e.ketone.Match(t)
+		if !ok {
+			return nil
+		}
+		result.Append(transform.NSToLibreKetoneEntry(t, value))
+		log.Debug().
+			Time("ts", t.CreatedAt.Local()).
+			Float64("ketone", value).
+			Str("eventType", t.EventType).
+			Msg("Ketone entry")
+		return nil
+	})
 
-			importGeneric := false
-			for _, m := range measurements {
-				modificator, ok := measurementMap[m]
-				if ok {
-					modificators = append(modificators, modificator)
-				}
-				if m == "generic" {
-					importGeneric = len(newSensorSerial) > 0
-				}
-			}
+	log.Info().
+		Int("count", len(result)).
+		Msg("Get ketone entries from Nightscout")
 
-			if importGeneric {
-				log.Info().
-					Str("serial", newSensorSerial).
-					Time("install time", lastScan.Timestamp).
-					Msg("Prepare sensor start generic entry")
-			}
+	return
+}
 
-			if dryRun || len(libreScheduledGlucoseEntries) == 0 || len(libreUnscheduledGlucoseEntries) == 0 || len(modificators) == 0 {
-				log.Info().
-					Bool("dry-run", dryRun).
-					Msg("Nothing to post")
-				return nil
-			}
+func (e *libreExporter) exerciseEntries(nsTreatments *nightscout.Treatments) (result libreview.GenericEntries) {
 
-			lv, err := libreview.NewWithConfig(settings.Libreview())
-			if err != nil {
-				return err
-			}
+	if cursor := e.state.Cursor(libreview.Exercise); cursor != nil {
+		nsTreatments = nsTreatments.Filter(nightscout.TreatmentOnlyAfter(*cursor))
+	}
 
-			if len(token) == 0 {
-				if err := lv.Auth(setDevice); err != nil {
-					return err
-				}
-			} else {
-				lv.SetToken(token)
-			}
+	nsTreatments.Visit(func(t *nightscout.Treatment, _ error) error {
+		if t.EventType != nightscout.EventTypeExercise {
+			return nil
+		}
+		result.Append(transform.NSExerciseToLibreGenericEntry(t))
+		log.Debug().
+			Time("ts", t.CreatedAt.Local()).
+			Float64("duration", t.Duration).
+			Msg("Exercise entry")
+		return nil
+	})
 
-			log.Debug().
-				Str("token", lv.Token()).
-				Msg("use token for libreview")
+	log.Info().
+		Int("count", len(result)).
+		Msg("Get exercise entries from Nightscout")
 
-			resp, err := lv.ImportMeasurements(modificators...)
-			if err != nil {
-				return err
-			}
+	return
+}
 
-			if len(libreGenericEntries) > 0 && importGeneric {
-				err := lv.NewSensor(newSensorSerial)
-				if err != nil {
-					log.Error().
-						Err(err).
-						Msg("Posible new sensor install failed")
-				}
-			}
+// noteEntries returns notes and announcements. Notes exported as ketone readings are skipped
+func (e *libreExporter) noteEntries(nsTreatments *nightscout.Treatments) (result libreview.GenericEntries) {
 
-			log.Info().
-				Int("scheduledGlucoseEntries", resp.Result.MeasurementCounts.ScheduledGlucoseCount).
-				Int("unscheduledGlucoseEntries", resp.Result.MeasurementCounts.UnScheduledGlucoseCount).
-				Int("insulin", resp.Result.MeasurementCounts.InsulinCount).
-				Int("food", resp.Result.MeasurementCounts.FoodCount).
-				Msg("Export measurements success")
-
-			lastTS = lv.LastImported()
-			if lastTS != nil && len(lastTimestampFile) > 0 && !dryRun {
-				if err := saveTS(lastTimestampFile, *lastTS); err != nil {
-					return err
-				}
-				log.Info().
-					Time("ts", *lastTS).
-					Str("timestampFile", lastTimestampFile).
-					Msg("Last scheduled glucose entry timestamp")
-			}
+	if cursor := e.state.Cursor(libreview.Note); cursor != nil {
+		nsTreatments = nsTreatments.Filter(nightscout.TreatmentOnlyAfter(*cursor))
+	}
 
+	exportKetone := slices.Contains(e.opts.measurements, libreview.Ketone)
+
+	nsTreatments.Visit(func(t *nightscout.Treatment, _ error) error {
+		if !transform.IsNote(t) {
+			return nil
+		}
+		if _, ok := e.ketone.Match(t); ok && exportKetone {
 			return nil
+		}
+		result.Append(transform.NSNoteToLibreGenericEntry(t))
+		log.Debug().
+			Time("ts", t.CreatedAt.Local()).
+			Str("notes", t.Notes).
+			Msg("Note entry")
+		return nil
+	})
 
-		},
+	log.Info().
+		Int("count", len(result)).
+		Msg("Get note entries from Nightscout")
+
+	return
+}
+
+// alarmEntries returns low and high glucose alarms (see transform.alarms config)
+func (e *libreExporter) alarmEntries(nsGlucoseEntries *nightscout.GlucoseEntries) (result libreview.GenericEntries) {
+
+	alarms := transform.NSToLibreAlarmEntries(*nsGlucoseEntries, settings.Transform().Alarms)
+
+	cursor := e.state.Cursor(libreview.Alarm)
+
+	for _, a := range alarms {
+		if cursor != nil && !a.Timestamp.After(*cursor) {
+			continue
+		}
+		result.Append(a)
+		log.Debug().
+			Time("ts", a.Timestamp).
+			Str("type", a.Type).
+			Msg("Alarm entry")
 	}
 
-	fs := cmd.Flags()
+	log.Info().
+		Int("count", len(result)).
+		Msg("Prepare glucose alarm entries")
 
-	settings.AddListFlags(fs)
+	return
+}
 
-	fs.StringVar(&minInterval, "min-interval", "10m10s", "Filter: minimum sample interval (duration)")
-	fs.IntVar(&avgScanFrequency, "scan-frequency", 90, "Average scan frequency (minutes). e.g. scan internal min=avg-30%, max=avg+30%")
-	fs.BoolVar(&dryRun, "dry-run", false, "Do not post measurement to LibreView")
-	fs.BoolVar(&setDevice, "set-device", true, "Set this app as main user device. Necessary if the main device was set by another application (e.g. Librelink)")
-	fs.StringVar(&lastTimestampFile, "last-ts-file", "", "Path to last timestamp file (for example ./last.ts )")
-	fs.StringSliceVar(&measurements, "measurements", libreview.AllMeasurements, "measurements to upload")
-	fs.StringVar(&token, "token", "", "use existing libreview token (beta)")
-	fs.StringVar(&newSensorSerial, "install-new-sensor-sn", "", "new sensor serial number")
+// saveState moves the cursors of exported measurement types and records the upload
+func (e *libreExporter) saveState(lv libreview.Client, resp *libreview.LibreViewExportResp, exported []string) error {
 
-	err := fs.MarkHidden("token")
-	if err != nil {
-		panic(err)
+	e.saveHistory()
+
+	for _, m := range exported {
+		if ts := lv.LastImportedAt(m); ts != nil {
+			e.state.SetCursor(m, *ts)
+		}
 	}
 
-	return cmd
+	counts := resp.Result.MeasurementCounts
+
+	e.state.AddUpload(state.Upload{
+		UploadID:  resp.Result.UploadID,
+		CreatedAt: time.Now().UTC(),
+		Counts: map[string]int{
+			libreview.ScheduledGlucose:   counts.ScheduledGlucoseCount,
+			libreview.UnscheduledGlucose: counts.UnScheduledGlucoseCount,
+			libreview.Insulin:            counts.InsulinCount,
+			libreview.Food:               counts.FoodCount,
+			libreview.Generic:            counts.GenericCount,
+			libreview.BloodGlucose:       counts.BloodGlucoseCount,
+			libreview.Ketone:             counts.KetoneCount,
+		},
+	})
+
+	if err := e.state.Save(); err != nil {
+		return errors.Wrap(err, "cant save state")
+	}
+
+	if len(e.state.Path()) > 0 {
+		log.Info().
+			Str("uploadId", resp.Result.UploadID).
+			Str("stateFile", e.state.Path()).
+			Msg("Sync state saved")
+	}
+
+	// legacy timestamp file
+	if ts := lv.LastImported(); ts != nil && len(e.opts.lastTimestampFile) > 0 {
+		if err := saveTS(e.opts.lastTimestampFile, *ts); err != nil {
+			return err
+		}
+		log.Info().
+			Time("ts", *ts).
+			Str("timestampFile", e.opts.lastTimestampFile).
+			Msg("Last scheduled glucose entry timestamp")
+	}
+
+	return nil
 }
 
 func saveTS(tsfile string, ts time.Time) error {
@@ -324,12 +1181,3 @@ func getLastTS(tsfile string) (*time.Time, error) {
 
 	return &t, nil
 }
-
-func Percent(percent int, all int) float64 {
-	return ((float64(all) * float64(percent)) / float64(100))
-}
-
-func getRangeSpread(avgVal, percentSpread int) (min, max int) {
-	return int(float64(avgVal) - Percent(percentSpread, avgVal)),
-		int(float64(avgVal) + Percent(percentSpread, avgVal))
-}
@@ -0,0 +1,510 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/blutz1982/go-nsexporter-libreview/pkg/env"
+	"github.com/blutz1982/go-nsexporter-libreview/pkg/libreview"
+	"github.com/blutz1982/go-nsexporter-libreview/pkg/nightscout"
+	"github.com/blutz1982/go-nsexporter-libreview/pkg/rest"
+	"github.com/blutz1982/go-nsexporter-libreview/pkg/scansim"
+)
+
+var loadConfigOnce sync.Once
+
+// loadTestConfig loads the default config once, the config is global
+func loadTestConfig(t *testing.T) {
+	t.Helper()
+
+	loadConfigOnce.Do(func() {
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		if err := os.WriteFile(path, []byte(env.DefaultConfigYaml), 0600); err != nil {
+			t.Fatal(err)
+		}
+		settings.ConfigPath = path
+		if err := settings.LoadConfig(); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+// nightscoutServer serves entries and treatments like Nightscout API v1
+type nightscoutServer struct {
+	*httptest.Server
+
+	mu         sync.Mutex
+	entries    nightscout.GlucoseEntries
+	treatments nightscout.Treatments
+	requests   map[string]int
+}
+
+func newNightscoutServer(t *testing.T) *nightscoutServer {
+	t.Helper()
+
+	s := &nightscoutServer{requests: make(map[string]int)}
+	s.Server = httptest.NewServer(s)
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func (s *nightscoutServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q := r.URL.Query()
+	count, _ := strconv.Atoi(q.Get("count"))
+
+	var page []any
+
+	switch {
+	case strings.Contains(r.URL.Path, "/entries"):
+		s.requests["entries"]++
+		from, _ := strconv.ParseInt(q.Get("find[date][$gte]"), 10, 64)
+		to, _ := strconv.ParseInt(q.Get("find[date][$lte]"), 10, 64)
+
+		sorted := append(nightscout.GlucoseEntries(nil), s.entries...)
+		sort.SliceStable(sorted, func(i, j int) bool {
+			return sorted[i].Date.Time().After(sorted[j].Date.Time())
+		})
+		for _, e := range sorted {
+			ms := e.Date.Time().UnixMilli()
+			if ms < from || ms > to || (len(q.Get("find[type]")) > 0 && e.Type != q.Get("find[type]")) {
+				continue
+			}
+			page = append(page, e)
+		}
+	case strings.Contains(r.URL.Path, "/treatments"):
+		s.requests["treatments"]++
+		from := q.Get("find[created_at][$gte]")
+		to := q.Get("find[created_at][$lte]")
+
+		sorted := append(nightscout.Treatments(nil), s.treatments...)
+		sort.SliceStable(sorted, func(i, j int) bool {
+			return sorted[i].CreatedAt.After(sorted[j].CreatedAt)
+		})
+		for _, tr := range sorted {
+			createdAt := tr.CreatedAt.UTC().Format(time.RFC3339)
+			if createdAt < from || createdAt > to {
+				continue
+			}
+			page = append(page, tr)
+		}
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	if count > 0 && len(page) > count {
+		page = page[:count]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+func (s *nightscoutServer) Requests(resource string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[resource]
+}
+
+// libreViewServer records posted measurements and sensors
+type libreViewServer struct {
+	*httptest.Server
+
+	mu           sync.Mutex
+	measurements []libreview.MeasurementLog
+	sensors      []string
+	// sensorStatus is http status of new sensor requests
+	sensorStatus int
+}
+
+func newLibreViewServer(t *testing.T) *libreViewServer {
+	t.Helper()
+
+	s := &libreViewServer{sensorStatus: http.StatusOK}
+	s.Server = httptest.NewServer(s)
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func (s *libreViewServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+
+	switch {
+	case r.URL.Path == "/lsl/api/measurements":
+		m := new(libreview.Measurements)
+		if err := json.NewDecoder(r.Body).Decode(m); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.measurements = append(s.measurements, m.DeviceData.MeasurementLog)
+		w.Write([]byte(`{"status":0}`))
+	case r.URL.Path == "/lsl/api/nisperson" && r.Method == http.MethodPut:
+		sensor := new(libreview.Sensor)
+		if err := json.NewDecoder(r.Body).Decode(sensor); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if s.sensorStatus != http.StatusOK {
+			w.WriteHeader(s.sensorStatus)
+			w.Write([]byte(`{"status":1}`))
+			return
+		}
+		s.sensors = append(s.sensors, sensor.DomainData)
+		w.Write([]byte(`{"status":0}`))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// testExportOptions returns defaults of the libreview command flags
+func testExportOptions(stateFile string) *libreExportOptions {
+	return &libreExportOptions{
+		historyInterval:  nightscout.DefaultHistoryInterval,
+		historyAggregate: nightscout.AggregateMean,
+		avgScanFrequency: 90,
+		gapThreshold:     20 * time.Minute,
+		scanStrategy:     scansim.StrategyUniform,
+		stateFile:        stateFile,
+		measurements:     libreview.DefaultMeasurements,
+		debounce:         30 * time.Second,
+	}
+}
+
+func newTestExporter(t *testing.T, ns *nightscoutServer, lv *libreViewServer, opts *libreExportOptions) *libreExporter {
+	t.Helper()
+
+	loadTestConfig(t)
+
+	nsClient, err := nightscout.New(ns.URL, rest.WithRetryPolicy(rest.NoRetry()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := newLibreExporter(nsClient, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := *settings.Libreview()
+	cfg.ImportConfig.APIEndpoint = lv.URL
+	e.lv, err = libreview.NewWithConfig(&cfg,
+		libreview.WithRetryPolicy(rest.NoRetry()),
+		libreview.WithLedger(exportLedger{e.state}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.lv.SetToken("token")
+
+	return e
+}
+
+// socketIOServer is socket.io server with engine.io long polling transport. The events are sent
+// after authorization, polls without packets are answered with noop after a short wait
+type socketIOServer struct {
+	*httptest.Server
+
+	events  []string
+	packets chan string
+}
+
+func newSocketIOServer(t *testing.T, events ...string) *socketIOServer {
+	t.Helper()
+
+	s := &socketIOServer{
+		events:  events,
+		packets: make(chan string, 16),
+	}
+	s.Server = httptest.NewServer(s)
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func (s *socketIOServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		body, _ := io.ReadAll(r.Body)
+		for _, p := range strings.Split(string(body), "\x1e") {
+			switch {
+			case p == "40":
+				s.packets <- "40"
+			case strings.HasPrefix(p, `42`) && strings.Contains(p, `"authorize"`):
+				id := p[2:strings.IndexByte(p, '[')]
+				s.packets <- "43" + id + `[{"read":true}]`
+				for _, event := range s.events {
+					s.packets <- event
+				}
+			}
+		}
+		w.Write([]byte("ok"))
+		return
+	}
+
+	if len(r.URL.Query().Get("sid")) == 0 {
+		w.Write([]byte(`0{"sid":"abc","pingInterval":25000,"pingTimeout":20000}`))
+		return
+	}
+
+	select {
+	case p := <-s.packets:
+		w.Write([]byte(p))
+	case <-time.After(50 * time.Millisecond):
+		w.Write([]byte("6"))
+	case <-r.Context().Done():
+	}
+}
+
+func TestWatchNightscoutTrigger(t *testing.T) {
+
+	ns := newNightscoutServer(t)
+	lv := newLibreViewServer(t)
+
+	opts := testExportOptions("")
+	opts.debounce = 100 * time.Millisecond
+	e := newTestExporter(t, ns, lv, opts)
+
+	sio := newSocketIOServer(t,
+		// the first update after connect is not a delta, it does not trigger export
+		`42["dataUpdate",{"delta":false,"sgvs":[{"mgdl":100}]}]`,
+		// updates within debounce are exported together
+		`42["dataUpdate",{"delta":true,"sgvs":[{"mgdl":100}]}]`,
+		`42["dataUpdate",{"delta":true,"treatments":[{"eventType":"Note"}]}]`,
+	)
+
+	listener, err := nightscout.NewListener(sio.URL, nightscout.ListenerAuth{APIToken: "token"}, sio.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- e.Watch(ctx, time.Hour, nightscoutTrigger(ctx, listener))
+	}()
+
+	// one export on start and one after the updates, every export requests treatments once
+	deadline := time.Now().Add(5 * time.Second)
+	for ns.Requests("treatments") < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d exports, want 2", ns.Requests("treatments"))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	time.Sleep(3 * opts.debounce)
+	if got := ns.Requests("treatments"); got != 2 {
+		t.Fatalf("got %d exports, want 2", got)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+// posted returns count of posted entries of the generic type
+func (s *libreViewServer) posted(genericType string) (count int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, m := range s.measurements {
+		for _, e := range m.GenericEntries {
+			if e.Type == genericType {
+				count++
+			}
+		}
+	}
+	return
+}
+
+func (s *libreViewServer) announced() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.sensors...)
+}
+
+func TestExportSensorStart(t *testing.T) {
+
+	now := time.Now()
+
+	tests := []struct {
+		name       string
+		treatments nightscout.Treatments
+		serial     string
+	}{
+		{
+			name: "sensor start treatment",
+			treatments: nightscout.Treatments{
+				{EventType: nightscout.EventTypeSensorStart, CreatedAt: now.Add(-2 * time.Hour).UTC(), Notes: "0M0008B8CTR"},
+			},
+		},
+		{
+			// the current time is the install time, the serial is announced once
+			name:   "serial flag",
+			serial: "0M0008B8CTR",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ns := newNightscoutServer(t)
+			ns.treatments = tt.treatments
+			lv := newLibreViewServer(t)
+
+			stateFile := filepath.Join(t.TempDir(), "state.json")
+
+			// every run is a new process with the same state file
+			export := func() {
+				opts := testExportOptions(stateFile)
+				opts.measurements = []string{libreview.SensorStart}
+				opts.newSensorSerial = tt.serial
+				e := newTestExporter(t, ns, lv, opts)
+				if err := e.Export(context.Background(), now.Add(-24*time.Hour), now); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// the announcement fails, the entry is posted and the sensor is announced again next time
+			lv.sensorStatus = http.StatusInternalServerError
+			export()
+			if got := lv.posted(libreview.GenericTypeSensorStart); got != 1 {
+				t.Fatalf("got %d sensorstart entries, want 1", got)
+			}
+			if got := lv.announced(); len(got) != 0 {
+				t.Fatalf("got announced %v", got)
+			}
+
+			lv.sensorStatus = http.StatusOK
+			export()
+			if got := lv.posted(libreview.GenericTypeSensorStart); got != 2 {
+				t.Fatalf("got %d sensorstart entries, want 2", got)
+			}
+			if got := lv.announced(); len(got) != 1 || !strings.Contains(got[0], "0M0008B8CTR") {
+				t.Fatalf("got announced %v", got)
+			}
+
+			// announced sensor is skipped
+			export()
+			if got := lv.posted(libreview.GenericTypeSensorStart); got != 2 {
+				t.Fatalf("got %d sensorstart entries, want 2", got)
+			}
+			if got := lv.announced(); len(got) != 1 {
+				t.Fatalf("got announced %v", got)
+			}
+		})
+	}
+}
+
+// scheduled returns offsets of posted scheduled glucose entries from base and their values
+func (s *libreViewServer) scheduled(base time.Time) (offsets []time.Duration, values []float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, m := range s.measurements {
+		for _, e := range m.ScheduledContinuousGlucoseEntries {
+			ts := time.Unix(e.RecordNumber-libreview.RecordNumberIncrement, 0)
+			offsets = append(offsets, ts.Sub(base))
+			values = append(values, e.ValueInMgPerDl)
+		}
+	}
+	return
+}
+
+// addReadings adds sgv readings every 5 minutes in [from, to) minutes after base, sgv is 100 + minutes
+func (s *nightscoutServer) addReadings(base time.Time, from, to int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for m := from; m < to; m += 5 {
+		date := nightscout.NSTime(base.Add(time.Duration(m) * time.Minute))
+		s.entries = append(s.entries, &nightscout.GlucoseEntry{
+			ID:   strconv.Itoa(m),
+			Date: &date,
+			Sgv:  nightscout.SVG(100 + m),
+			Type: nightscout.Sgv,
+		})
+	}
+}
+
+func TestExportScheduledGlucoseRuns(t *testing.T) {
+
+	// grid without anchors is aligned to Unix epoch
+	base := time.Now().Truncate(nightscout.DefaultHistoryInterval).Add(-6 * time.Hour)
+	at := func(m int) time.Time {
+		return base.Add(time.Duration(m) * time.Minute)
+	}
+
+	ns := newNightscoutServer(t)
+	lv := newLibreViewServer(t)
+
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+
+	export := func(dateTo time.Time) {
+		opts := testExportOptions(stateFile)
+		opts.measurements = []string{libreview.ScheduledGlucose}
+		opts.fillGaps = 45 * time.Minute
+		e := newTestExporter(t, ns, lv, opts)
+		if err := e.Export(context.Background(), base.Add(-time.Hour), dateTo); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	minutes := func(values ...int) (result []time.Duration) {
+		for _, v := range values {
+			result = append(result, time.Duration(v)*time.Minute)
+		}
+		return
+	}
+
+	// the sensor stops after the reading 55
+	ns.addReadings(base, 0, 60)
+	export(at(62))
+
+	offsets, values := lv.scheduled(base)
+	if want := minutes(45, 30, 15, 0); !slices.Equal(offsets, want) {
+		t.Fatalf("first run: got %v, want %v", offsets, want)
+	}
+
+	// the readings of the exported bucket 45 (45, 50, 55) are not exported again. The reading 55 is the left edge
+	// of the gap before the reading 100, the gap is filled
+	ns.addReadings(base, 100, 140)
+	export(at(137))
+
+	offsets, values = lv.scheduled(base)
+	if want := minutes(45, 30, 15, 0, 120, 105, 90, 75, 60); !slices.Equal(offsets, want) {
+		t.Fatalf("second run: got %v, want %v", offsets, want)
+	}
+
+	// filled readings are used only in the buckets without readings (60 and 75)
+	if want := []float64{225, 210, 200, 180, 165}; !slices.Equal(values[4:], want) {
+		t.Fatalf("second run: got values %v, want %v", values[4:], want)
+	}
+
+	// nothing new
+	export(at(140))
+	if offsets, _ = lv.scheduled(base); len(offsets) != 9 {
+		t.Fatalf("third run: got %v", offsets)
+	}
+}
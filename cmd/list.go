@@ -103,6 +103,7 @@ func newListTreatment(ctx context.Context) *cobra.Command {
 				DateFrom: dateFrom,
 				DateTo:   dateTo,
 				Count:    settings.NightscoutMaxEnties(),
+				PageSize: settings.NightscoutPageSize(),
 			})
 			if err != nil {
 				return err
@@ -147,6 +148,7 @@ func newListGlucose(ctx context.Context) *cobra.Command {
 				DateFrom: dateFrom,
 				DateTo:   dateTo,
 				Count:    settings.NightscoutMaxEnties(),
+				PageSize: settings.NightscoutPageSize(),
 			})
 			if err != nil {
 				return err
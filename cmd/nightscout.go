@@ -0,0 +1,150 @@
+package cmd
+
+import (
+	"context"
+	"time"
+
+	"github.com/blutz1982/go-nsexporter-libreview/pkg/libreview"
+	"github.com/blutz1982/go-nsexporter-libreview/pkg/nightscout"
+	"github.com/blutz1982/go-nsexporter-libreview/pkg/transform"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+func newNightscoutCommand(ctx context.Context) *cobra.Command {
+
+	cmd := &cobra.Command{
+		Use:           "nightscout",
+		Short:         "import data to nightscout",
+		PreRun:        preRun(),
+		PostRun:       postRun(),
+		SilenceUsage:  true,
+		SilenceErrors: true,
+	}
+
+	cmd.AddCommand(
+		newImportFromLibreview(ctx),
+	)
+
+	return cmd
+}
+
+func newImportFromLibreview(ctx context.Context) *cobra.Command {
+
+	var (
+		dryRun       bool
+		patientID    string
+		dedupeWindow time.Duration
+	)
+
+	cmd := &cobra.Command{
+		Use:           "import-from-libreview",
+		Short:         "import LibreView (LibreLinkUp) glucose readings to nightscout",
+		PreRun:        preRun(),
+		PostRun:       postRun(),
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+
+			dateFrom, dateTo, err := settings.DateRange()
+			if err != nil {
+				return err
+			}
+
+			ns, err := getNightscoutClient(ctx)
+			if err != nil {
+				return err
+			}
+
+			lu, err := libreview.NewLinkUpWithConfig(settings.Libreview(), libreviewClientOpts()...)
+			if err != nil {
+				return err
+			}
+
+			if err := lu.Login(ctx); err != nil {
+				return err
+			}
+
+			if len(patientID) == 0 {
+				patientID = settings.Libreview().LinkUp.PatientID
+			}
+
+			libreLog, err := lu.Measurements(ctx, patientID)
+			if err != nil {
+				return err
+			}
+
+			inRange := func(ts time.Time) bool {
+				return !ts.Before(dateFrom) && !ts.After(dateTo)
+			}
+
+			existingGlucose, err := ns.Glucose().List(ctx, nightscout.ListOptions{
+				Kind:     nightscout.Sgv,
+				DateFrom: dateFrom.Add(-dedupeWindow),
+				DateTo:   dateTo.Add(dedupeWindow),
+				Count:    settings.NightscoutMaxEnties(),
+				PageSize: settings.NightscoutPageSize(),
+			})
+			if err != nil {
+				return err
+			}
+
+			var nsGlucoseEntries nightscout.GlucoseEntries
+
+			appendGlucose := func(e *nightscout.GlucoseEntry) {
+				ts := e.Date.Time()
+				if !inRange(ts) || existingGlucose.Near(ts, dedupeWindow) || nsGlucoseEntries.Near(ts, dedupeWindow) {
+					return
+				}
+				nsGlucoseEntries.Append(e)
+				log.Debug().
+					Time("ts", ts.Local()).
+					Float64("svg", e.Sgv.Float64()).
+					Str("direction", e.Direction).
+					Msg("Glucose entry")
+			}
+
+			libreLog.ScheduledContinuousGlucoseEntries.Visit(func(e *libreview.ScheduledContinuousGlucoseEntry, _ error) error {
+				appendGlucose(transform.LibreScheduledGlucoseToNSEntry(e))
+				return nil
+			})
+
+			libreLog.UnscheduledContinuousGlucoseEntries.Visit(func(e *libreview.UnscheduledContinuousGlucoseEntry, _ error) error {
+				appendGlucose(transform.LibreUnscheduledGlucoseToNSEntry(e))
+				return nil
+			})
+
+			log.Info().
+				Int("glucose", nsGlucoseEntries.Len()).
+				Time("fromDate", dateFrom).
+				Time("toDate", dateTo).
+				Msg("New entries from LibreView")
+
+			if dryRun || nsGlucoseEntries.Len() == 0 {
+				log.Info().
+					Bool("dry-run", dryRun).
+					Msg("Nothing to post")
+				return nil
+			}
+
+			created, err := ns.Glucose().Create(ctx, nsGlucoseEntries)
+			if err != nil {
+				return err
+			}
+
+			log.Info().
+				Int("count", created.Len()).
+				Msg("Glucose entries created")
+
+			return nil
+		},
+	}
+
+	fs := cmd.Flags()
+	settings.AddListFlags(fs)
+	fs.BoolVar(&dryRun, "dry-run", false, "Do not post entries to Nightscout")
+	fs.StringVar(&patientID, "patient-id", "", "LibreLinkUp patient id (default - libreview.linkUp.patientId from config or the first connection)")
+	fs.DurationVar(&dedupeWindow, "dedupe-window", 2*time.Minute, "Skip entries if Nightscout has an entry within this window")
+
+	return cmd
+}
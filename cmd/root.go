@@ -4,11 +4,14 @@ import (
 	"context"
 	"crypto/sha1"
 	"encoding/hex"
+	"net/http"
 	"time"
 
 	"github.com/blutz1982/go-nsexporter-libreview/internal/version"
 	"github.com/blutz1982/go-nsexporter-libreview/pkg/env"
+	"github.com/blutz1982/go-nsexporter-libreview/pkg/libreview"
 	"github.com/blutz1982/go-nsexporter-libreview/pkg/nightscout"
+	"github.com/blutz1982/go-nsexporter-libreview/pkg/rest"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
@@ -90,28 +93,68 @@ func NewRootCmd(ctx context.Context, args []string) *cobra.Command {
 		newGraphommand(ctx),
 		newLibreAuth(ctx),
 		newLibreNewSensor(ctx),
+		newNightscoutCommand(ctx),
 	)
 
 	return cmd
 
 }
 
+func libreviewClientOpts(opts ...libreview.ClientOpt) []libreview.ClientOpt {
+	return append([]libreview.ClientOpt{
+		libreview.WithRetryPolicy(settings.RetryPolicy()),
+		libreview.WithTransport(settings.HTTPTransport()),
+	}, opts...)
+}
+
+// getNightscoutListener returns real-time events listener. Config must be loaded
+func getNightscoutListener() (*nightscout.Listener, error) {
+	auth := nightscout.ListenerAuth{
+		APIToken: settings.Nightscout().APIToken,
+	}
+
+	if len(settings.Nightscout().APISecret) > 0 {
+		hash := sha1.Sum([]byte(settings.Nightscout().APISecret))
+		auth = nightscout.ListenerAuth{
+			APISecret: hex.EncodeToString(hash[:]),
+		}
+	}
+
+	client := &http.Client{
+		Transport: settings.HTTPTransport()(http.DefaultTransport.(*http.Transport).Clone()),
+	}
+
+	return nightscout.NewListener(settings.Nightscout().URL, auth, client)
+}
+
 func getNightscoutClient(ctx context.Context) (nightscout.Client, error) {
 	if err := settings.LoadConfig(); err != nil {
 		return nil, errors.Wrap(err, "cant load config")
 	}
 
+	opts := []rest.RESTClientOpt{
+		rest.WithRetryPolicy(settings.RetryPolicy()),
+		rest.WithTransport(settings.HTTPTransport()),
+	}
+
+	switch settings.Nightscout().APIVersion {
+	case "", nightscout.APIVersionV1:
+	case nightscout.APIVersionV3:
+		if len(settings.Nightscout().APIToken) == 0 {
+			return nil, errors.New("nightscout API v3 requires apiToken")
+		}
+		debug("used api v3 with api-token for auth")
+		return nightscout.NewV3WithAPIToken(ctx, settings.Nightscout().URL, settings.Nightscout().APIToken, opts...)
+	default:
+		return nil, errors.Errorf("unsupported nightscout apiVersion %q (v1 or v3)", settings.Nightscout().APIVersion)
+	}
+
 	if len(settings.Nightscout().APISecret) > 0 {
 		hash := sha1.Sum([]byte(settings.Nightscout().APISecret))
 		debug("used api-secret for auth")
-		return nightscout.NewWithAPISecret(settings.Nightscout().URL, hex.EncodeToString(hash[:]))
-	}
-
-	jwtToken, err := nightscout.NewJWTToken(ctx, settings.Nightscout().URL, settings.Nightscout().APIToken)
-	if err != nil {
-		return nil, err
+		return nightscout.NewWithAPISecret(settings.Nightscout().URL, hex.EncodeToString(hash[:]), opts...)
 	}
 
 	debug("used api-token for auth")
-	return nightscout.NewWithJWTToken(settings.Nightscout().URL, jwtToken)
+	return nightscout.NewWithAPIToken(ctx, settings.Nightscout().URL, settings.Nightscout().APIToken, opts...)
 }
@@ -3,12 +3,15 @@ package env
 import (
 	// "fmt"
 
+	"net/http"
 	"os"
 	"time"
 
 	"github.com/blutz1982/go-nsexporter-libreview/pkg/libreview"
 	"github.com/blutz1982/go-nsexporter-libreview/pkg/nightscout"
 	"github.com/blutz1982/go-nsexporter-libreview/pkg/printer"
+	"github.com/blutz1982/go-nsexporter-libreview/pkg/rest"
+	"github.com/blutz1982/go-nsexporter-libreview/pkg/transform"
 	"github.com/gookit/config/v2"
 	"github.com/gookit/config/v2/yaml"
 	"github.com/spf13/pflag"
@@ -37,11 +40,64 @@ libreview:
       uniqueIdentifier: ""
     domain: Libreview
     gatewayType: FSLibreLink.Android
+    sensorProfile: libre2
     uom: mmol/L
+  linkUp:
+    apiEndpoint: https://api.libreview.io
+    auth:
+      password: ""
+      username: ""
+    patientId: ""
+    product: llu.android
+    version: 4.12.0
+  # sensor profiles override or extend the built-in libre1, libre2, libre2plus, libre3 and dexcom profiles
+  # sensors:
+  #   libre2plus:
+  #     gatewayTypes:
+  #     - FSLibreLink.Android
+  #     - FSLibreLink.iOS
+  #     gmax: 500
+  #     gmin: 40
+  #     productType: 2
+  #     warmupTime: 60
+  #     wearDuration: 21600
 nightscout:
   apiToken: ""
   apiSecret: ""
+  apiVersion: v1
   url: ""
+transform:
+  ketone:
+    eventTypes:
+    - Note
+    - Ketones
+    notesPattern: '(?i)ketones?\s*[:=]?\s*([0-9]+(?:[.,][0-9]+)?)'
+  alarms:
+    high: 240
+    low: 70
+  food:
+    eventTypes:
+      Carb Correction: Snack
+      Snack Bolus: Snack
+    mealTimes:
+    - foodType: Breakfast
+      from: "05:00"
+      to: "11:00"
+    - foodType: Lunch
+      from: "11:00"
+      to: "16:00"
+    - foodType: Dinner
+      from: "16:00"
+      to: "22:00"
+    - foodType: Snack
+      from: "22:00"
+      to: "05:00"
+  # insulins are added to the built-in catalog (Fiasp, Novorapid, Lantus, Tresiba, ...), an insulin overrides the built-in one with the same name
+  # insulins:
+  # - name: Semglee
+  #   action: long
+  #   aliases:
+  #   - Rezvoglar
 `
 
 const (
@@ -51,6 +107,7 @@ const (
 type file struct {
 	Nightscout *nightscout.Config `yaml:"nightscout"`
 	Libreview  *libreview.Config  `yaml:"libreview"`
+	Transform  *transform.Config  `yaml:"transform"`
 }
 
 type EnvSettings struct {
@@ -58,16 +115,29 @@ type EnvSettings struct {
 	ConfigPath string
 	Debug      bool
 	Timezone   string
+	Retry      RetryFlags
+	Trace      TraceFlags
 	config     *file
 	listFlags  *ListFlags
 }
 
+type RetryFlags struct {
+	MaxAttempts int
+	Backoff     time.Duration
+}
+
+type TraceFlags struct {
+	HTTP bool
+	Body bool
+}
+
 type ListFlags struct {
 	tsLayout   string
 	fromDate   string
 	dateOffset string
 	toDate     string
 	count      int
+	pageSize   int
 	printer    string
 }
 
@@ -80,9 +150,14 @@ func New() *EnvSettings {
 		ConfigPath: "config.yaml",
 		Debug:      false,
 		Timezone:   "",
+		Retry: RetryFlags{
+			MaxAttempts: rest.DefaultRetryMaxAttempts,
+			Backoff:     rest.DefaultRetryBackoff,
+		},
 		listFlags: &ListFlags{
 			tsLayout: defaultTSLayout,
 			count:    nightscout.MaxEnties,
+			pageSize: nightscout.DefaultPageSize,
 			printer:  printer.YAMLPrinter,
 		},
 	}
@@ -94,6 +169,10 @@ func (s *EnvSettings) AddCommonFlags(fs *pflag.FlagSet) {
 	fs.StringVarP(&s.ConfigPath, "config", "c", s.ConfigPath, "path to config")
 	fs.BoolVarP(&s.Debug, "debug", "d", s.Debug, "toggle debug")
 	fs.StringVar(&s.Timezone, "timezone", s.Timezone, "override timezone")
+	fs.IntVar(&s.Retry.MaxAttempts, "retry-max-attempts", s.Retry.MaxAttempts, "max attempts for failed HTTP requests (network errors, 429 and 5xx)")
+	fs.DurationVar(&s.Retry.Backoff, "retry-backoff", s.Retry.Backoff, "initial backoff between retries, doubled on each attempt")
+	fs.BoolVar(&s.Trace.HTTP, "trace-http", s.Trace.HTTP, "log HTTP requests (method, url, status, latency). Secrets are redacted")
+	fs.BoolVar(&s.Trace.Body, "trace-http-body", s.Trace.Body, "log HTTP request and response bodies with --trace-http")
 }
 
 func (s *EnvSettings) AddListFlags(fs *pflag.FlagSet) {
@@ -101,7 +180,12 @@ func (s *EnvSettings) AddListFlags(fs *pflag.FlagSet) {
 	fs.StringVar(&s.listFlags.fromDate, "date-from", "", "Start of sampling period")
 	fs.StringVar(&s.listFlags.dateOffset, "date-offset", "", "Start of sampling period with current time offset. Set in duration (e.g. 24h or 72h30m). Ignore --date-from and --date-to flags")
 	fs.StringVar(&s.listFlags.toDate, "date-to", "", "End of sampling period")
-	fs.IntVar(&s.listFlags.count, "max-count", s.listFlags.count, "nightscout max count entries per API request")
+	fs.IntVar(&s.listFlags.count, "max-count", s.listFlags.count, "nightscout max count entries")
+	fs.IntVar(&s.listFlags.pageSize, "page-size", s.listFlags.pageSize, "nightscout max count entries per API request")
+	fs.StringVarP(&s.listFlags.printer, "output", "o", s.listFlags.printer, "output (json or yaml)")
+}
+
+func (s *EnvSettings) AddOutputFlags(fs *pflag.FlagSet) {
 	fs.StringVarP(&s.listFlags.printer, "output", "o", s.listFlags.printer, "output (json or yaml)")
 }
 
@@ -109,10 +193,33 @@ func (s *EnvSettings) DateRange() (fromDate, toDate time.Time, err error) {
 	return getDateRange(s.listFlags)
 }
 
+// HasDateRange reports whether the date range is set by --date-from or --date-offset (not the default today)
+func (s *EnvSettings) HasDateRange() bool {
+	return len(s.listFlags.fromDate) > 0 || len(s.listFlags.dateOffset) > 0
+}
+
 func (s *EnvSettings) NightscoutMaxEnties() int {
 	return s.listFlags.count
 }
 
+func (s *EnvSettings) NightscoutPageSize() int {
+	return s.listFlags.pageSize
+}
+
+func (s *EnvSettings) RetryPolicy() *rest.RetryPolicy {
+	return rest.NewRetryPolicy(s.Retry.MaxAttempts, s.Retry.Backoff)
+}
+
+// HTTPTransport returns wrapper for http transports according to trace flags
+func (s *EnvSettings) HTTPTransport() func(http.RoundTripper) http.RoundTripper {
+	return func(rt http.RoundTripper) http.RoundTripper {
+		if !s.Trace.HTTP {
+			return rt
+		}
+		return rest.NewTraceRoundTripper(rt, s.Trace.Body)
+	}
+}
+
 func (s *EnvSettings) OutFormat() string {
 	return s.listFlags.printer
 }
@@ -143,6 +250,17 @@ func (s *EnvSettings) LoadConfig() error {
 		f.Libreview = new(libreview.Config)
 	}
 
+	// config profiles override the defaults with the same name
+	sensors := libreview.DefaultSensorProfiles()
+	for name, profile := range f.Libreview.Sensors {
+		sensors[name] = profile
+	}
+	f.Libreview.Sensors = sensors
+
+	if f.Transform == nil {
+		f.Transform = transform.DefaultConfig()
+	}
+
 	s.config = f
 
 	return nil
@@ -169,6 +287,10 @@ func (s *EnvSettings) Libreview() *libreview.Config {
 	return s.config.Libreview
 }
 
+func (s *EnvSettings) Transform() *transform.Config {
+	return s.config.Transform
+}
+
 func (s *EnvSettings) SetNightscout(cfg *nightscout.Config) {
 	s.config.Nightscout = cfg
 }
@@ -74,6 +74,16 @@ func (es UnscheduledContinuousGlucoseEntries) Visit(fn UnscheduledVisitorFunc) e
 	return nil
 }
 
+func (es UnscheduledContinuousGlucoseEntries) Filter(fn func(*UnscheduledContinuousGlucoseEntry) bool) (result UnscheduledContinuousGlucoseEntries) {
+	es.Visit(func(e *UnscheduledContinuousGlucoseEntry, _ error) error {
+		if fn(e) {
+			result.Append(e)
+		}
+		return nil
+	})
+	return result
+}
+
 func (es UnscheduledContinuousGlucoseEntries) Last() (*UnscheduledContinuousGlucoseEntry, bool) {
 	var entry *UnscheduledContinuousGlucoseEntry
 	es.Visit(func(e *UnscheduledContinuousGlucoseEntry, _ error) error {
@@ -111,7 +121,47 @@ func NewUnscheduledFromScheduledContinuousGlucoseEntry(s *ScheduledContinuousGlu
 	return entry
 }
 
-type GenericExtendedProperties struct {
+const (
+	// Generic entry types
+	GenericTypeSensorStart = "com.abbottdiabetescare.informatics.sensorstart"
+	GenericTypeExercise    = "com.abbottdiabetescare.informatics.exercise"
+	GenericTypeCustomNote  = "com.abbottdiabetescare.informatics.customnote"
+	GenericTypeAlarmLow    = "com.abbottdiabetescare.informatics.ondemandalarm.low"
+	GenericTypeAlarmHigh   = "com.abbottdiabetescare.informatics.ondemandalarm.high"
+)
+
+// genericRecordNumberOffsets keeps record numbers of generic entries of different types
+// with the same timestamp unique
+var genericRecordNumberOffsets = map[string]int64{
+	GenericTypeSensorStart: 0,
+	GenericTypeExercise:    10000000000,
+	GenericTypeCustomNote:  20000000000,
+	GenericTypeAlarmLow:    30000000000,
+	GenericTypeAlarmHigh:   40000000000,
+}
+
+// GenericRecordNumber returns record number of generic entry
+func GenericRecordNumber(genericType string, ts time.Time) int64 {
+	return RecordNumberIncrementGeneric + genericRecordNumberOffsets[genericType] + ts.Unix()
+}
+
+// GenericMeasurement returns measurement type of generic entry type
+func GenericMeasurement(genericType string) string {
+	switch genericType {
+	case GenericTypeSensorStart:
+		return SensorStart
+	case GenericTypeExercise:
+		return Exercise
+	case GenericTypeCustomNote:
+		return Note
+	case GenericTypeAlarmLow, GenericTypeAlarmHigh:
+		return Alarm
+	default:
+		return Generic
+	}
+}
+
+type SensorStartExtendedProperties struct {
 	FactoryTimestamp time.Time `json:"factoryTimestamp"`
 	Gmin             string    `json:"gmin"`
 	Gmax             string    `json:"gmax"`
@@ -120,11 +170,29 @@ type GenericExtendedProperties struct {
 	ProductType      string    `json:"productType"`
 }
 
+type ExerciseExtendedProperties struct {
+	FactoryTimestamp  time.Time `json:"factoryTimestamp"`
+	DurationInMinutes int       `json:"durationInMinutes"`
+	Intensity         string    `json:"intensity,omitempty"`
+}
+
+type CustomNoteExtendedProperties struct {
+	FactoryTimestamp time.Time `json:"factoryTimestamp"`
+	Text             string    `json:"text"`
+}
+
+type AlarmExtendedProperties struct {
+	FactoryTimestamp   time.Time `json:"factoryTimestamp"`
+	GlucoseInMgPerDl   float64   `json:"glucoseInMgPerDl"`
+	ThresholdInMgPerDl float64   `json:"thresholdInMgPerDl"`
+}
+
+// GenericEntry has extended properties of its type (e.g. SensorStartExtendedProperties for GenericTypeSensorStart)
 type GenericEntry struct {
-	Type               string                    `json:"type"`
-	ExtendedProperties GenericExtendedProperties `json:"extendedProperties"`
-	RecordNumber       int64                     `json:"recordNumber"`
-	Timestamp          time.Time                 `json:"timestamp"`
+	Type               string    `json:"type"`
+	ExtendedProperties any       `json:"extendedProperties"`
+	RecordNumber       int64     `json:"recordNumber"`
+	Timestamp          time.Time `json:"timestamp"`
 }
 
 type GenericEntries []*GenericEntry
@@ -133,6 +201,25 @@ func (r *GenericEntries) Append(e *GenericEntry) {
 	*r = append(*r, e)
 }
 
+func (r GenericEntries) Filter(fn func(*GenericEntry) bool) (result GenericEntries) {
+	for _, e := range r {
+		if fn(e) {
+			result.Append(e)
+		}
+	}
+	return result
+}
+
+func (r GenericEntries) Last() (*GenericEntry, bool) {
+	var entry *GenericEntry
+	for _, e := range r {
+		if entry == nil || e.Timestamp.After(entry.Timestamp) {
+			entry = e
+		}
+	}
+	return entry, (entry != nil)
+}
+
 type ScheduledContinuousGlucoseEntry struct {
 	ValueInMgPerDl     float64            `json:"valueInMgPerDl"`
 	ExtendedProperties ExtendedProperties `json:"extendedProperties"`
@@ -194,20 +281,64 @@ type FoodEntry struct {
 	Timestamp          time.Time                   `json:"timestamp"`
 	GramsCarbs         int                         `json:"gramsCarbs"`
 	FoodType           string                      `json:"foodType"`
+	// SourceID is the Nightscout _id of the treatment (not uploaded)
+	SourceID string `json:"-"`
 }
 
+const (
+	FoodTypeBreakfast = "Breakfast"
+	FoodTypeLunch     = "Lunch"
+	FoodTypeDinner    = "Dinner"
+	FoodTypeSnack     = "Snack"
+	FoodTypeUnknown   = "Unknown"
+)
+
+var FoodTypes = []string{FoodTypeBreakfast, FoodTypeLunch, FoodTypeDinner, FoodTypeSnack, FoodTypeUnknown}
+
 type FoodEntries []*FoodEntry
 
 func (fes *FoodEntries) Append(e *FoodEntry) {
 	*fes = append(*fes, e)
 }
 
+func (fes FoodEntries) Filter(fn func(*FoodEntry) bool) (result FoodEntries) {
+	for _, e := range fes {
+		if fn(e) {
+			result.Append(e)
+		}
+	}
+	return result
+}
+
+func (fes FoodEntries) Last() (*FoodEntry, bool) {
+	var entry *FoodEntry
+	for _, e := range fes {
+		if entry == nil || e.Timestamp.After(entry.Timestamp) {
+			entry = e
+		}
+	}
+	return entry, (entry != nil)
+}
+
 type InsulinEntry struct {
 	ExtendedProperties TreatmentExtendedProperties `json:"extendedProperties"`
 	RecordNumber       int64                       `json:"recordNumber"`
 	Timestamp          time.Time                   `json:"timestamp"`
 	Units              float64                     `json:"units"`
 	InsulinType        string                      `json:"insulinType"`
+	// SourceID is the Nightscout _id of the treatment (not uploaded)
+	SourceID string `json:"-"`
+}
+
+// injections of one treatment have the same timestamp, so the record number is shifted by injection index
+const (
+	insulinRecordNumberStep = 10000000000
+	MaxInsulinInjections    = 10
+)
+
+// InsulinRecordNumber returns record number of the index-th injection of the treatment
+func InsulinRecordNumber(index int, ts time.Time) int64 {
+	return RecordNumberIncrementInsulin + int64(index)*insulinRecordNumberStep + ts.Unix()
 }
 
 type InsulinEntries []*InsulinEntry
@@ -216,6 +347,106 @@ func (ies *InsulinEntries) Append(e *InsulinEntry) {
 	*ies = append(*ies, e)
 }
 
+func (ies InsulinEntries) Filter(fn func(*InsulinEntry) bool) (result InsulinEntries) {
+	for _, e := range ies {
+		if fn(e) {
+			result.Append(e)
+		}
+	}
+	return result
+}
+
+func (ies InsulinEntries) Last() (*InsulinEntry, bool) {
+	var entry *InsulinEntry
+	for _, e := range ies {
+		if entry == nil || e.Timestamp.After(entry.Timestamp) {
+			entry = e
+		}
+	}
+	return entry, (entry != nil)
+}
+
+type BloodGlucoseExtendedProperties struct {
+	FactoryTimestamp       time.Time `json:"factoryTimestamp"`
+	LowOutOfRange          string    `json:"lowOutOfRange"`
+	HighOutOfRange         string    `json:"highOutOfRange"`
+	IsFirstAfterTimeChange bool      `json:"isFirstAfterTimeChange"`
+	CanMerge               string    `json:"canMerge"`
+}
+
+// BloodGlucoseEntry is a fingerstick reading
+type BloodGlucoseEntry struct {
+	ValueInMgPerDl     float64                        `json:"valueInMgPerDl"`
+	ExtendedProperties BloodGlucoseExtendedProperties `json:"extendedProperties"`
+	RecordNumber       int64                          `json:"recordNumber"`
+	Timestamp          time.Time                      `json:"timestamp"`
+}
+
+type BloodGlucoseEntries []*BloodGlucoseEntry
+
+func (bes *BloodGlucoseEntries) Append(e *BloodGlucoseEntry) {
+	*bes = append(*bes, e)
+}
+
+func (bes BloodGlucoseEntries) Filter(fn func(*BloodGlucoseEntry) bool) (result BloodGlucoseEntries) {
+	for _, e := range bes {
+		if fn(e) {
+			result.Append(e)
+		}
+	}
+	return result
+}
+
+func (bes BloodGlucoseEntries) Last() (*BloodGlucoseEntry, bool) {
+	var entry *BloodGlucoseEntry
+	for _, e := range bes {
+		if entry == nil || e.Timestamp.After(entry.Timestamp) {
+			entry = e
+		}
+	}
+	return entry, (entry != nil)
+}
+
+type KetoneExtendedProperties struct {
+	FactoryTimestamp       time.Time `json:"factoryTimestamp"`
+	LowOutOfRange          string    `json:"lowOutOfRange"`
+	HighOutOfRange         string    `json:"highOutOfRange"`
+	IsFirstAfterTimeChange bool      `json:"isFirstAfterTimeChange"`
+}
+
+// KetoneEntry is a blood ketone reading
+type KetoneEntry struct {
+	ValueInMmolPerL    float64                  `json:"valueInMmolPerL"`
+	ExtendedProperties KetoneExtendedProperties `json:"extendedProperties"`
+	RecordNumber       int64                    `json:"recordNumber"`
+	Timestamp          time.Time                `json:"timestamp"`
+}
+
+type KetoneEntries []*KetoneEntry
+
+func (kes *KetoneEntries) Append(e *KetoneEntry) {
+	*kes = append(*kes, e)
+}
+
+func (kes KetoneEntries) Filter(fn func(*KetoneEntry) bool) (result KetoneEntries) {
+	for _, e := range kes {
+		if fn(e) {
+			result.Append(e)
+		}
+	}
+	return result
+}
+
+func (kes KetoneEntries) Last() (*KetoneEntry, bool) {
+	var entry *KetoneEntry
+	for _, e := range kes {
+		if entry == nil || e.Timestamp.After(entry.Timestamp) {
+			entry = e
+		}
+	}
+	return entry, (entry != nil)
+}
+
 type FactoryConfig struct {
 	Uom string `json:"UOM"`
 }
@@ -249,15 +480,131 @@ type Device struct {
 
 type MeasurementLog struct {
 	Capabilities                        []string                            `json:"capabilities"`
-	BloodGlucoseEntries                 []any                               `json:"bloodGlucoseEntries"`
+	BloodGlucoseEntries                 BloodGlucoseEntries                 `json:"bloodGlucoseEntries"`
 	GenericEntries                      GenericEntries                      `json:"genericEntries"`
-	KetoneEntries                       []any                               `json:"ketoneEntries"`
+	KetoneEntries                       KetoneEntries                       `json:"ketoneEntries"`
 	ScheduledContinuousGlucoseEntries   ScheduledContinuousGlucoseEntries   `json:"scheduledContinuousGlucoseEntries"`
 	InsulinEntries                      InsulinEntries                      `json:"insulinEntries"`
 	FoodEntries                         FoodEntries                         `json:"foodEntries"`
 	UnscheduledContinuousGlucoseEntries UnscheduledContinuousGlucoseEntries `json:"unscheduledContinuousGlucoseEntries"`
 }
 
+// LastTimestamps returns the timestamp of the last entry for each not empty measurement type
+func (l *MeasurementLog) LastTimestamps() map[string]time.Time {
+	result := make(map[string]time.Time)
+
+	if e, ok := l.ScheduledContinuousGlucoseEntries.Last(); ok {
+		result[ScheduledGlucose] = e.Timestamp
+	}
+	if e, ok := l.UnscheduledContinuousGlucoseEntries.Last(); ok {
+		result[UnscheduledGlucose] = e.Timestamp
+	}
+	if e, ok := l.InsulinEntries.Last(); ok {
+		result[Insulin] = e.Timestamp
+	}
+	if e, ok := l.FoodEntries.Last(); ok {
+		result[Food] = e.Timestamp
+	}
+	for _, e := range l.GenericEntries {
+		m := GenericMeasurement(e.Type)
+		if ts, ok := result[m]; !ok || e.Timestamp.After(ts) {
+			result[m] = e.Timestamp
+		}
+	}
+	if e, ok := l.BloodGlucoseEntries.Last(); ok {
+		result[BloodGlucose] = e.Timestamp
+	}
+	if e, ok := l.KetoneEntries.Last(); ok {
+		result[Ketone] = e.Timestamp
+	}
+
+	return result
+}
+
+// Len returns the count of all entries
+func (l *MeasurementLog) Len() int {
+	return len(l.ScheduledContinuousGlucoseEntries) +
+		len(l.UnscheduledContinuousGlucoseEntries) +
+		len(l.InsulinEntries) +
+		len(l.FoodEntries) +
+		len(l.GenericEntries) +
+		len(l.BloodGlucoseEntries) +
+		len(l.KetoneEntries)
+}
+
+// SkipUploaded removes entries already recorded in ledger
+func (l *MeasurementLog) SkipUploaded(ledger Ledger) {
+	l.ScheduledContinuousGlucoseEntries = l.ScheduledContinuousGlucoseEntries.Filter(func(e *ScheduledContinuousGlucoseEntry) bool {
+		return !ledger.Uploaded(ScheduledGlucose, e.RecordNumber)
+	})
+	l.UnscheduledContinuousGlucoseEntries = l.UnscheduledContinuousGlucoseEntries.Filter(func(e *UnscheduledContinuousGlucoseEntry) bool {
+		return !ledger.Uploaded(UnscheduledGlucose, e.RecordNumber)
+	})
+	l.InsulinEntries = l.InsulinEntries.Filter(func(e *InsulinEntry) bool {
+		return !ledger.Uploaded(Insulin, e.RecordNumber)
+	})
+	l.FoodEntries = l.FoodEntries.Filter(func(e *FoodEntry) bool {
+		return !ledger.Uploaded(Food, e.RecordNumber)
+	})
+	l.GenericEntries = l.GenericEntries.Filter(func(e *GenericEntry) bool {
+		return !ledger.Uploaded(GenericMeasurement(e.Type), e.RecordNumber)
+	})
+	l.BloodGlucoseEntries = l.BloodGlucoseEntries.Filter(func(e *BloodGlucoseEntry) bool {
+		return !ledger.Uploaded(BloodGlucose, e.RecordNumber)
+	})
+	l.KetoneEntries = l.KetoneEntries.Filter(func(e *KetoneEntry) bool {
+		return !ledger.Uploaded(Ketone, e.RecordNumber)
+	})
+
+	// keep empty arrays (not null) in json
+	if l.ScheduledContinuousGlucoseEntries == nil {
+		l.ScheduledContinuousGlucoseEntries = ScheduledContinuousGlucoseEntries{}
+	}
+	if l.UnscheduledContinuousGlucoseEntries == nil {
+		l.UnscheduledContinuousGlucoseEntries = UnscheduledContinuousGlucoseEntries{}
+	}
+	if l.InsulinEntries == nil {
+		l.InsulinEntries = InsulinEntries{}
+	}
+	if l.FoodEntries == nil {
+		l.FoodEntries = FoodEntries{}
+	}
+	if l.GenericEntries == nil {
+		l.GenericEntries = GenericEntries{}
+	}
+	if l.BloodGlucoseEntries == nil {
+		l.BloodGlucoseEntries = BloodGlucoseEntries{}
+	}
+	if l.KetoneEntries == nil {
+		l.KetoneEntries = KetoneEntries{}
+	}
+}
+
+// AddToLedger records all entries as uploaded
+func (l *MeasurementLog) AddToLedger(ledger Ledger) {
+	for _, e := range l.ScheduledContinuousGlucoseEntries {
+		ledger.AddUploaded(ScheduledGlucose, e.RecordNumber, e.Timestamp)
+	}
+	for _, e := range l.UnscheduledContinuousGlucoseEntries {
+		ledger.AddUploaded(UnscheduledGlucose, e.RecordNumber, e.Timestamp)
+	}
+	for _, e := range l.InsulinEntries {
+		ledger.AddUploaded(Insulin, e.RecordNumber, e.Timestamp)
+	}
+	for _, e := range l.FoodEntries {
+		ledger.AddUploaded(Food, e.RecordNumber, e.Timestamp)
+	}
+	for _, e := range l.GenericEntries {
+		ledger.AddUploaded(GenericMeasurement(e.Type), e.RecordNumber, e.Timestamp)
+	}
+	for _, e := range l.BloodGlucoseEntries {
+		ledger.AddUploaded(BloodGlucose, e.RecordNumber, e.Timestamp)
+	}
+	for _, e := range l.KetoneEntries {
+		ledger.AddUploaded(Ketone, e.RecordNumber, e.Timestamp)
+	}
+}
+
 type DeviceData struct {
 	DeviceSettings DeviceSettings   `json:"deviceSettings"`
 	Header         DeviceDataHeader `json:"header"`
@@ -271,6 +618,10 @@ type Measurements struct {
 	DeviceData  DeviceData `json:"DeviceData"`
 }
 
+func (m *Measurements) Kind() string {
+	return "Measurements"
+}
+
 type Sensor struct {
 	Domain      string     `json:"Domain"`
 	DomainData  string     `json:"DomainData"`
@@ -279,6 +630,10 @@ type Sensor struct {
 	DeviceData  DeviceData `json:"DeviceData"`
 }
 
+func (s *Sensor) Kind() string {
+	return "Sensor"
+}
+
 type APILibreViewAuth struct {
 	Culture     string `json:"Culture"`
 	DeviceId    string `json:"DeviceId"`
@@ -289,6 +644,10 @@ type APILibreViewAuth struct {
 	Password    string `json:"Password"`
 }
 
+func (a *APILibreViewAuth) Kind() string {
+	return "APILibreViewAuth"
+}
+
 type LibreViewExportResp struct {
 	Status int    `json:"status"`
 	Reason string `json:"reason"`
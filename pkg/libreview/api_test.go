@@ -0,0 +1,152 @@
+package libreview
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// ledger is in-memory Ledger
+type ledger map[string]map[int64]time.Time
+
+func (l ledger) Uploaded(measurement string, recordNumber int64) bool {
+	_, ok := l[measurement][recordNumber]
+	return ok
+}
+
+func (l ledger) AddUploaded(measurement string, recordNumber int64, ts time.Time) {
+	if l[measurement] == nil {
+		l[measurement] = make(map[int64]time.Time)
+	}
+	l[measurement][recordNumber] = ts
+}
+
+func testMeasurementLog(ts time.Time) *MeasurementLog {
+	return &MeasurementLog{
+		ScheduledContinuousGlucoseEntries: ScheduledContinuousGlucoseEntries{
+			{RecordNumber: 1, Timestamp: ts},
+			{RecordNumber: 2, Timestamp: ts},
+		},
+		UnscheduledContinuousGlucoseEntries: UnscheduledContinuousGlucoseEntries{
+			{RecordNumber: 1, Timestamp: ts},
+			{RecordNumber: 2, Timestamp: ts},
+		},
+		InsulinEntries: InsulinEntries{
+			{RecordNumber: 1, Timestamp: ts},
+			{RecordNumber: 2, Timestamp: ts},
+		},
+		FoodEntries: FoodEntries{
+			{RecordNumber: 1, Timestamp: ts},
+			{RecordNumber: 2, Timestamp: ts},
+		},
+		GenericEntries: GenericEntries{
+			{Type: GenericTypeSensorStart, RecordNumber: 1, Timestamp: ts},
+			{Type: GenericTypeExercise, RecordNumber: 1, Timestamp: ts},
+			{Type: GenericTypeCustomNote, RecordNumber: 2, Timestamp: ts},
+			{Type: GenericTypeAlarmLow, RecordNumber: 2, Timestamp: ts},
+		},
+		BloodGlucoseEntries: BloodGlucoseEntries{
+			{RecordNumber: 1, Timestamp: ts},
+			{RecordNumber: 2, Timestamp: ts},
+		},
+		KetoneEntries: KetoneEntries{
+			{RecordNumber: 1, Timestamp: ts},
+			{RecordNumber: 2, Timestamp: ts},
+		},
+	}
+}
+
+func TestSkipUploaded(t *testing.T) {
+
+	ts := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+
+	// record number 1 of every measurement type is uploaded. The same record number of other type is not
+	l := ledger{}
+	for _, m := range []string{ScheduledGlucose, UnscheduledGlucose, Insulin, Food, SensorStart, Exercise, BloodGlucose, Ketone} {
+		l.AddUploaded(m, 1, ts)
+	}
+
+	log := testMeasurementLog(ts)
+	log.SkipUploaded(l)
+
+	tests := []struct {
+		measurement string
+		got         int
+		want        int
+	}{
+		{ScheduledGlucose, len(log.ScheduledContinuousGlucoseEntries), 1},
+		{UnscheduledGlucose, len(log.UnscheduledContinuousGlucoseEntries), 1},
+		{Insulin, len(log.InsulinEntries), 1},
+		{Food, len(log.FoodEntries), 1},
+		{"generic", len(log.GenericEntries), 2},
+		{BloodGlucose, len(log.BloodGlucoseEntries), 1},
+		{Ketone, len(log.KetoneEntries), 1},
+	}
+
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s: got %d entries, want %d", tt.measurement, tt.got, tt.want)
+		}
+	}
+
+	if log.Len() != 8 {
+		t.Errorf("got %d entries, want 8", log.Len())
+	}
+
+	for _, e := range log.GenericEntries {
+		if e.RecordNumber != 2 {
+			t.Errorf("generic entry %s %d is not skipped", e.Type, e.RecordNumber)
+		}
+	}
+
+	// the second run skips everything
+	log.AddToLedger(l)
+	log.SkipUploaded(l)
+	if log.Len() != 0 {
+		t.Fatalf("got %d entries after AddToLedger, want 0", log.Len())
+	}
+
+	// LibreView expects empty arrays
+	data, err := json.Marshal(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{
+		"scheduledContinuousGlucoseEntries",
+		"unscheduledContinuousGlucoseEntries",
+		"insulinEntries",
+		"foodEntries",
+		"genericEntries",
+		"bloodGlucoseEntries",
+		"ketoneEntries",
+	} {
+		if string(fields[name]) != "[]" {
+			t.Errorf("%s: got %s, want []", name, fields[name])
+		}
+	}
+}
+
+func TestAddToLedger(t *testing.T) {
+
+	ts := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+
+	l := ledger{}
+	testMeasurementLog(ts).AddToLedger(l)
+
+	for _, m := range []string{ScheduledGlucose, UnscheduledGlucose, Insulin, Food, BloodGlucose, Ketone} {
+		if len(l[m]) != 2 {
+			t.Errorf("%s: got %d records, want 2", m, len(l[m]))
+		}
+	}
+
+	// generic entries are recorded by their measurement type
+	for m, want := range map[string]int64{SensorStart: 1, Exercise: 1, Note: 2, Alarm: 2} {
+		if len(l[m]) != 1 || !l.Uploaded(m, want) {
+			t.Errorf("%s: got %v, want record %d", m, l[m], want)
+		}
+	}
+}
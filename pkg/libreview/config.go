@@ -1,5 +1,25 @@
 package libreview
 
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+const (
+	SensorProfileLibre1     = "libre1"
+	SensorProfileLibre2     = "libre2"
+	SensorProfileLibre2Plus = "libre2plus"
+	SensorProfileLibre3     = "libre3"
+	SensorProfileDexcom     = "dexcom"
+
+	DefaultSensorProfile = SensorProfileLibre2
+
+	UomMmol = "mmol/L"
+	UomMg   = "mg/dL"
+)
+
 type Auth struct {
 	Username string `yaml:"username"`
 	Password string `yaml:"password"`
@@ -21,15 +41,136 @@ type DevSettings struct {
 }
 
 type ImportConfig struct {
-	APIEndpoint string      `yaml:"apiEndpoint"`
-	Domain      string      `yaml:"domain"`
-	Culture     string      `yaml:"culture"`
-	GatewayType string      `yaml:"gatewayType"`
-	Uom         string      `yaml:"uom"`
-	DevSettings DevSettings `yaml:"deviceSettings"`
+	APIEndpoint string `yaml:"apiEndpoint"`
+	Domain      string `yaml:"domain"`
+	Culture     string `yaml:"culture"`
+	GatewayType string `yaml:"gatewayType"`
+	Uom         string `yaml:"uom"`
+	// the field name differs from the key, so mapstructure tag is needed for config decoding
+	DevSettings DevSettings `yaml:"deviceSettings" mapstructure:"deviceSettings"`
+	// SensorProfile is the name of the sensor profile (see Config.Sensors)
+	SensorProfile string `yaml:"sensorProfile"`
+}
+
+// SensorProfile describes sensor model in sensorstart generic entries
+type SensorProfile struct {
+	// Gmin and Gmax is the measurement range (mg/dL)
+	Gmin int `yaml:"gmin"`
+	Gmax int `yaml:"gmax"`
+	// WearDuration and WarmupTime in minutes
+	WearDuration int `yaml:"wearDuration"`
+	WarmupTime   int `yaml:"warmupTime"`
+	ProductType  int `yaml:"productType"`
+	// GatewayTypes allowed for the sensor. Any gateway if empty
+	GatewayTypes []string `yaml:"gatewayTypes"`
+}
+
+// Validate checks the profile values and import config against the profile
+func (p SensorProfile) Validate(cfg ImportConfig) error {
+	if p.Gmin <= 0 || p.Gmax <= p.Gmin {
+		return fmt.Errorf("bad measurement range %d-%d", p.Gmin, p.Gmax)
+	}
+	if p.WearDuration <= 0 {
+		return fmt.Errorf("bad wear duration %d", p.WearDuration)
+	}
+	if p.WarmupTime < 0 || p.WarmupTime >= p.WearDuration {
+		return fmt.Errorf("bad warmup time %d", p.WarmupTime)
+	}
+	if len(p.GatewayTypes) > 0 && !slices.Contains(p.GatewayTypes, cfg.GatewayType) {
+		return fmt.Errorf("gateway type %q not allowed, expected one of %s", cfg.GatewayType, strings.Join(p.GatewayTypes, ", "))
+	}
+	if cfg.Uom != UomMmol && cfg.Uom != UomMg {
+		return fmt.Errorf("bad uom %q, expected %s or %s", cfg.Uom, UomMmol, UomMg)
+	}
+	return nil
+}
+
+func DefaultSensorProfiles() map[string]SensorProfile {
+	libreGateways := []string{"FSLibreLink.Android", "FSLibreLink.iOS"}
+	return map[string]SensorProfile{
+		SensorProfileLibre1: {
+			Gmin:         40,
+			Gmax:         500,
+			WearDuration: 20160,
+			WarmupTime:   60,
+			ProductType:  0,
+			GatewayTypes: libreGateways,
+		},
+		SensorProfileLibre2: {
+			Gmin:         40,
+			Gmax:         500,
+			WearDuration: 20160,
+			WarmupTime:   60,
+			ProductType:  2,
+			GatewayTypes: libreGateways,
+		},
+		SensorProfileLibre2Plus: {
+			Gmin:         40,
+			Gmax:         500,
+			WearDuration: 21600,
+			WarmupTime:   60,
+			ProductType:  2,
+			GatewayTypes: libreGateways,
+		},
+		SensorProfileLibre3: {
+			Gmin:         40,
+			Gmax:         500,
+			WearDuration: 20160,
+			WarmupTime:   60,
+			ProductType:  4,
+			GatewayTypes: []string{"FSLibreLink3.Android", "FSLibreLink3.iOS"},
+		},
+		SensorProfileDexcom: {
+			Gmin:         40,
+			Gmax:         400,
+			WearDuration: 14400,
+			WarmupTime:   120,
+			ProductType:  2,
+		},
+	}
+}
+
+// LinkUpConfig is LibreLinkUp API config (used to download data from LibreView)
+type LinkUpConfig struct {
+	// Auth is the follower account, it differs from the patient account of libreview auth
+	Auth        Auth   `yaml:"auth"`
+	APIEndpoint string `yaml:"apiEndpoint"`
+	Product     string `yaml:"product"`
+	Version     string `yaml:"version"`
+	PatientID   string `yaml:"patientId"`
 }
 
 type Config struct {
 	Auth         Auth         `yaml:"auth"`
 	ImportConfig ImportConfig `yaml:"importConfig"`
+	LinkUp       LinkUpConfig `yaml:"linkUp"`
+	// Sensors is sensor profiles by name. Config profiles are added to DefaultSensorProfiles
+	Sensors map[string]SensorProfile `yaml:"sensors"`
+}
+
+// SensorProfile returns the validated sensor profile by name.
+// importConfig.sensorProfile (or DefaultSensorProfile) is used if the name is empty
+func (c *Config) SensorProfile(name string) (*SensorProfile, error) {
+	if len(name) == 0 {
+		name = c.ImportConfig.SensorProfile
+	}
+	if len(name) == 0 {
+		name = DefaultSensorProfile
+	}
+
+	profile, ok := c.Sensors[name]
+	if !ok {
+		names := make([]string, 0, len(c.Sensors))
+		for n := range c.Sensors {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, NewLibreViewError(fmt.Errorf("unknown sensor profile %q, expected one of %s", name, strings.Join(names, ", ")), "sensor profile")
+	}
+
+	if err := profile.Validate(c.ImportConfig); err != nil {
+		return nil, NewLibreViewError(err, fmt.Sprintf("sensor profile %q", name))
+	}
+
+	return &profile, nil
 }
@@ -1,46 +1,166 @@
 package libreview
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
 	"time"
+
+	"github.com/blutz1982/go-nsexporter-libreview/pkg/rest"
+)
+
+const (
+	RecordNumberIncrement             = 160000000000
+	RecordNumberIncrementUnscheduled  = 260000000000
+	RecordNumberIncrementInsulin      = 360000000000
+	RecordNumberIncrementFood         = 460000000000
+	RecordNumberIncrementGeneric      = 560000000000
+	RecordNumberIncrementBloodGlucose = 660000000000
+	RecordNumberIncrementKetone       = 760000000000
+
+	versionedAPIPath = "lsl/api"
 )
 
 const (
-	RecordNumberIncrement            = 160000000000
-	RecordNumberIncrementUnscheduled = 260000000000
-	RecordNumberIncrementInsulin     = 360000000000
-	RecordNumberIncrementFood        = 460000000000
-	RecordNumberIncrementGeneric     = 560000000000
+	// Measurement types
+	ScheduledGlucose   = "scheduledContinuousGlucose"
+	UnscheduledGlucose = "unscheduledContinuousGlucose"
+	Insulin            = "insulin"
+	Food               = "food"
+	Generic            = "generic"
+	BloodGlucose       = "bloodGlucose"
+	Ketone             = "ketone"
+	Exercise           = "exercise"
+	Note               = "note"
+	Alarm              = "alarm"
+	SensorStart        = "sensorStart"
 )
 
 var AllMeasurements = []string{
-	"scheduledContinuousGlucose",
-	"unscheduledContinuousGlucose",
-	"insulin",
-	"food",
-	// "generic",
+	ScheduledGlucose,
+	UnscheduledGlucose,
+	Insulin,
+	Food,
+	BloodGlucose,
+	Ketone,
+	Exercise,
+	Note,
+	Alarm,
+	SensorStart,
+	// Generic,
+}
+
+// DefaultMeasurements is exported without --measurements. Generic entries (exercise, note, alarm and sensorStart) are opt-in
+var DefaultMeasurements = []string{
+	ScheduledGlucose,
+	UnscheduledGlucose,
+	Insulin,
+	Food,
+	BloodGlucose,
+	Ketone,
+}
+
+var contentConfig = rest.ClientContentConfig{
+	AcceptContentTypes: "application/json",
+	ContentType:        "application/json",
 }
 
 type Client interface {
-	ImportMeasurements(modificators ...MeasuremenModificator) (*LibreViewExportResp, error)
-	Auth(setDevice bool) error
+	ImportMeasurements(ctx context.Context, modificators ...MeasuremenModificator) (*LibreViewExportResp, error)
+	Auth(ctx context.Context, setDevice bool) error
+	Login(ctx context.Context, setDevice bool) error
+	Session() *Session
 	LastImported() *time.Time
+	LastImportedAt(measurement string) *time.Time
 	Token() string
 	SetToken(token string)
-	NewSensor(serial string) error
+	NewSensor(ctx context.Context, serial string) error
+}
+
+var ErrNothingToImport = errors.New("nothing to import: all entries already uploaded")
+
+type LibreViewError struct {
+	Err  error
+	Info string
+}
+
+func (lvErr *LibreViewError) Error() string {
+	return fmt.Sprintf("libreview client: %s: %v", lvErr.Info, lvErr.Err)
+}
+
+func (lvErr *LibreViewError) Unwrap() error {
+	return lvErr.Err
+}
+
+func NewLibreViewError(err error, info string) error {
+	return &LibreViewError{
+		Err:  err,
+		Info: info,
+	}
+}
+
+// StatusError is returned when LibreView responds with http status 200 but non-zero status in body
+type StatusError struct {
+	Status int
+	Reason string
+	Body   []byte
+}
+
+func (sErr *StatusError) Error() string {
+	return fmt.Sprintf("bad status %d (%s): body : %s", sErr.Status, sErr.Reason, sErr.Body)
+}
+
+// Ledger remembers record numbers of uploaded entries.
+// ImportMeasurements skips entries found in ledger and adds uploaded ones
+type Ledger interface {
+	Uploaded(measurement string, recordNumber int64) bool
+	AddUploaded(measurement string, recordNumber int64, ts time.Time)
+}
+
+type ClientOpt func(*libreview)
+
+func WithLedger(ledger Ledger) ClientOpt {
+	return func(lv *libreview) {
+		lv.ledger = ledger
+	}
+}
+
+func WithRetryPolicy(p *rest.RetryPolicy) ClientOpt {
+	return func(lv *libreview) {
+		lv.restOpts = append(lv.restOpts, rest.WithRetryPolicy(p))
+	}
+}
+
+// WithSessionCache sets path to file with cached session (user token).
+// The session is saved after each Auth and reused by Login
+func WithSessionCache(path string) ClientOpt {
+	return func(lv *libreview) {
+		lv.sessionCache = path
+	}
+}
+
+// WithTransport wraps http transport of the client (e.g. for logging)
+func WithTransport(wrap func(http.RoundTripper) http.RoundTripper) ClientOpt {
+	return func(lv *libreview) {
+		lv.transport = wrap(lv.transport)
+	}
 }
 
 type libreview struct {
-	config      *Config
-	apiEndpoint *url.URL
-	client      *http.Client
-	userToken   string
-	lastEntryTS *time.Time
+	config       *Config
+	restClient   rest.Interface
+	restOpts     []rest.RESTClientOpt
+	transport    http.RoundTripper
+	userToken    string
+	session      *Session
+	sessionCache string
+	// token was loaded from cache, it can be rejected
+	cachedToken  bool
+	setDevice    bool
+	lastImported map[string]time.Time
+	ledger       Ledger
 }
 
 func (lv *libreview) Token() string {
@@ -51,21 +171,57 @@ func (lv *libreview) SetToken(token string) {
 	lv.userToken = token
 }
 
-func NewWithConfig(config *Config) (Client, error) {
+func (lv *libreview) Session() *Session {
+	return lv.session
+}
+
+// Login uses cached session if any, otherwise calls Auth
+func (lv *libreview) Login(ctx context.Context, setDevice bool) error {
+	lv.setDevice = setDevice
+
+	if len(lv.sessionCache) > 0 {
+		session, err := LoadSession(lv.sessionCache)
+		if err != nil {
+			return NewLibreViewError(err, "cant load session cache")
+		}
+
+		if session != nil && session.BelongsTo(lv.config.Auth.Username) {
+			lv.session = session
+			lv.userToken = session.UserToken
+			lv.cachedToken = true
+			return nil
+		}
+	}
+
+	return lv.Auth(ctx, setDevice)
+}
+
+func NewWithConfig(config *Config, opts ...ClientOpt) (Client, error) {
 
 	u, err := url.Parse(config.ImportConfig.APIEndpoint)
 	if err != nil {
 		return nil, err
 	}
 
-	return &libreview{
-		client:      http.DefaultClient,
-		config:      config,
-		apiEndpoint: u,
-	}, nil
+	lv := &libreview{
+		config:    config,
+		transport: http.DefaultTransport.(*http.Transport).Clone(),
+	}
+
+	for _, opt := range opts {
+		opt(lv)
+	}
+
+	client := &http.Client{
+		Transport: lv.transport,
+	}
+
+	lv.restClient = rest.NewRESTClient(u, versionedAPIPath, contentConfig, client, lv.restOpts...)
+
+	return lv, nil
 }
 
-func (lv *libreview) Auth(setDevice bool) error {
+func (lv *libreview) Auth(ctx context.Context, setDevice bool) error {
 
 	apiAuth := &APILibreViewAuth{
 		Culture:     lv.config.ImportConfig.Culture,
@@ -77,39 +233,36 @@ func (lv *libreview) Auth(setDevice bool) error {
 		Password:    lv.config.Auth.Password,
 	}
 
-	body := new(bytes.Buffer)
-	if err := json.NewEncoder(body).Encode(apiAuth); err != nil {
-		return err
-	}
-
-	resp, err := lv.client.Post(lv.apiEndpoint.JoinPath("lsl", "api", "nisperson", "getauthentication").String(), "application/json", body)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	// debug
-	// data, err := httputil.DumpResponse(resp, true)
-	// if err != nil {
-	// 	return err
-	// }
-	// fmt.Println(string(data))
-
-	if resp.StatusCode != 200 {
-		return fmt.Errorf("Libreview auth: bad status code %d", resp.StatusCode)
-	}
-
 	authResponse := new(AuthResponse)
 
-	if err := json.NewDecoder(resp.Body).Decode(authResponse); err != nil {
-		return err
+	result := lv.restClient.Post().
+		Idempotent().
+		Resource("nisperson").
+		Name("getauthentication").
+		Body(apiAuth).
+		Do(ctx)
+
+	if err := result.Into(authResponse); err != nil {
+		return NewLibreViewError(err, "auth error")
 	}
 
-	if len(authResponse.Result.UserToken) == 0 {
-		return errors.New("cant get token")
+	if authResponse.Status != 0 || len(authResponse.Result.UserToken) == 0 {
+		return NewLibreViewError(&StatusError{
+			Status: authResponse.Status,
+			Body:   result.Body(),
+		}, "auth error: cant get token")
 	}
 
 	lv.userToken = authResponse.Result.UserToken
+	lv.session = NewSessionFromAuthResponse(authResponse)
+	lv.cachedToken = false
+	lv.setDevice = setDevice
+
+	if len(lv.sessionCache) > 0 {
+		if err := lv.session.Save(lv.sessionCache); err != nil {
+			return NewLibreViewError(err, "cant save session cache")
+		}
+	}
 
 	return nil
 
@@ -142,18 +295,26 @@ func WithFoodEntries(entries FoodEntries) MeasuremenModificator {
 	}
 }
 
-func WithGenericEntries(entries GenericEntries) MeasuremenModificator {
+func WithBloodGlucoseEntries(entries BloodGlucoseEntries) MeasuremenModificator {
 	return func(l *MeasurementLog) {
-		l.GenericEntries = entries
+		l.BloodGlucoseEntries = entries
 	}
 }
 
-func (lv *libreview) NewSensor(serial string) error {
+func WithKetoneEntries(entries KetoneEntries) MeasuremenModificator {
+	return func(l *MeasurementLog) {
+		l.KetoneEntries = entries
+	}
+}
 
-	// Mock exit
-	// if 0 == 0 {
-	// 	return fmt.Errorf("Not implemented yet")
-	// }
+// WithGenericEntries appends entries, so generic entries of several measurement types can be combined
+func WithGenericEntries(entries GenericEntries) MeasuremenModificator {
+	return func(l *MeasurementLog) {
+		l.GenericEntries = append(l.GenericEntries, entries...)
+	}
+}
+
+func (lv *libreview) NewSensor(ctx context.Context, serial string) error {
 
 	s := &Sensor{
 		Domain:      lv.config.ImportConfig.Domain,
@@ -162,39 +323,33 @@ func (lv *libreview) NewSensor(serial string) error {
 		UserToken:   lv.userToken,
 	}
 
-	body := new(bytes.Buffer)
-	if err := json.NewEncoder(body).Encode(s); err != nil {
-		return err
+	err := lv.restClient.Put().
+		Name("nisperson").
+		Body(s).
+		Do(ctx).
+		Error()
+
+	if err != nil && lv.cachedToken && isRejected(err) {
+		// cached token may be expired
+		if err := lv.Auth(ctx, lv.setDevice); err != nil {
+			return err
+		}
+		s.UserToken = lv.userToken
+		err = lv.restClient.Put().
+			Name("nisperson").
+			Body(s).
+			Do(ctx).
+			Error()
 	}
 
-	req, err := http.NewRequest(http.MethodPut, lv.apiEndpoint.JoinPath("lsl", "api", "nisperson").String(), body)
 	if err != nil {
-		return err
-	}
-
-	req.Header.Add("Content-Type", "application/json")
-
-	resp, err := lv.client.Do(req)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	// Debug
-	// data, err := httputil.DumpResponse(resp, true)
-	// if err != nil {
-	// 	return err
-	// }
-	// fmt.Println(string(data))
-
-	if resp.StatusCode != 200 {
-		return fmt.Errorf("Libreview post new sensor: bad http status code %d", resp.StatusCode)
+		return NewLibreViewError(err, "cant post new sensor")
 	}
 
 	return nil
 }
 
-func (lv *libreview) ImportMeasurements(modificators ...MeasuremenModificator) (exportResp *LibreViewExportResp, err error) {
+func (lv *libreview) ImportMeasurements(ctx context.Context, modificators ...MeasuremenModificator) (exportResp *LibreViewExportResp, err error) {
 
 	if len(modificators) == 0 {
 		return
@@ -246,9 +401,9 @@ func (lv *libreview) ImportMeasurements(modificators ...MeasuremenModificator) (
 					"generic-com.abbottdiabetescare.informatics.isfGlucoseAlarm",
 					"generic-com.abbottdiabetescare.informatics.alarmSetting",
 				},
-				BloodGlucoseEntries:                 []interface{}{},
+				BloodGlucoseEntries:                 BloodGlucoseEntries{},
 				GenericEntries:                      GenericEntries{},
-				KetoneEntries:                       []interface{}{},
+				KetoneEntries:                       KetoneEntries{},
 				ScheduledContinuousGlucoseEntries:   ScheduledContinuousGlucoseEntries{},
 				InsulinEntries:                      InsulinEntries{},
 				FoodEntries:                         FoodEntries{},
@@ -261,65 +416,98 @@ func (lv *libreview) ImportMeasurements(modificators ...MeasuremenModificator) (
 		fn(&m.DeviceData.MeasurementLog)
 	}
 
-	body := new(bytes.Buffer)
-	if err := json.NewEncoder(body).Encode(m); err != nil {
-		return nil, err
+	if lv.ledger != nil {
+		m.DeviceData.MeasurementLog.SkipUploaded(lv.ledger)
+		if m.DeviceData.MeasurementLog.Len() == 0 {
+			return nil, ErrNothingToImport
+		}
 	}
 
-	req, err := http.NewRequest(http.MethodPost, lv.apiEndpoint.JoinPath("lsl", "api", "measurements").String(), body)
+	exportResp, err = lv.postMeasurements(ctx, m)
+	if err != nil && lv.cachedToken && isRejected(err) {
+		// cached token may be expired
+		if err := lv.Auth(ctx, lv.setDevice); err != nil {
+			return nil, err
+		}
+		m.UserToken = lv.userToken
+		exportResp, err = lv.postMeasurements(ctx, m)
+	}
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Add("Content-Type", "application/json")
 
-	// debug
-	// data, err := httputil.DumpRequest(req, true)
-	// if err != nil {
-	// 	return nil, err
-	// }
-	// fmt.Println(string(data))
+	lv.lastImported = m.DeviceData.MeasurementLog.LastTimestamps()
 
-	resp, err := lv.client.Do(req)
-	if err != nil {
-		return nil, err
+	if lv.ledger != nil {
+		m.DeviceData.MeasurementLog.AddToLedger(lv.ledger)
 	}
-	defer resp.Body.Close()
 
-	// data, err := httputil.DumpResponse(resp, true)
-	// if err != nil {
-	// 	return nil, err
-	// }
-	// fmt.Println(string(data))
+	// Stub
+	// For some reason the API does not return exportResp.Result.MeasurementCounts
+	exportResp.Result.MeasurementCounts.ScheduledGlucoseCount = len(m.DeviceData.MeasurementLog.ScheduledContinuousGlucoseEntries)
+	exportResp.Result.MeasurementCounts.UnScheduledGlucoseCount = len(m.DeviceData.MeasurementLog.UnscheduledContinuousGlucoseEntries)
+	exportResp.Result.MeasurementCounts.InsulinCount = len(m.DeviceData.MeasurementLog.InsulinEntries)
+	exportResp.Result.MeasurementCounts.FoodCount = len(m.DeviceData.MeasurementLog.FoodEntries)
+	exportResp.Result.MeasurementCounts.BloodGlucoseCount = len(m.DeviceData.MeasurementLog.BloodGlucoseEntries)
+	exportResp.Result.MeasurementCounts.KetoneCount = len(m.DeviceData.MeasurementLog.KetoneEntries)
+	exportResp.Result.MeasurementCounts.GenericCount = len(m.DeviceData.MeasurementLog.GenericEntries)
 
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("Libreview post measurements: bad http status code %d", resp.StatusCode)
-	}
+	return
+}
 
-	exportResp = new(LibreViewExportResp)
+func (lv *libreview) postMeasurements(ctx context.Context, m *Measurements) (*LibreViewExportResp, error) {
+	exportResp := new(LibreViewExportResp)
 
-	if err := json.NewDecoder(resp.Body).Decode(exportResp); err != nil {
-		return nil, err
+	result := lv.restClient.Post().
+		Name("measurements").
+		Body(m).
+		Do(ctx)
+
+	if err := result.Into(exportResp); err != nil {
+		return nil, NewLibreViewError(err, "cant post measurements")
 	}
 
 	if exportResp.Status != 0 {
-		return nil, fmt.Errorf("Libreview post measurements: bad status code %d", exportResp.Status)
+		return nil, NewLibreViewError(&StatusError{
+			Status: exportResp.Status,
+			Reason: exportResp.Reason,
+			Body:   result.Body(),
+		}, "cant post measurements")
+	}
+
+	return exportResp, nil
+}
+
+// isRejected reports whether request was rejected by LibreView because of auth (e.g. expired token).
+// LibreView responds with auth status either in http status or in status field of the body
+func isRejected(err error) bool {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return isAuthStatus(statusErr.Status)
 	}
 
-	e, ok := m.DeviceData.MeasurementLog.ScheduledContinuousGlucoseEntries.Last()
-	if ok {
-		lv.lastEntryTS = &e.Timestamp
+	var resultErr rest.ResultError
+	if errors.As(err, &resultErr) {
+		return isAuthStatus(resultErr.StatusCode())
 	}
 
-	// Stub
-	// For some reason the API does not return exportResp.Result.MeasurementCounts
-	exportResp.Result.MeasurementCounts.ScheduledGlucoseCount = len(m.DeviceData.MeasurementLog.ScheduledContinuousGlucoseEntries)
-	exportResp.Result.MeasurementCounts.UnScheduledGlucoseCount = len(m.DeviceData.MeasurementLog.UnscheduledContinuousGlucoseEntries)
-	exportResp.Result.MeasurementCounts.InsulinCount = len(m.DeviceData.MeasurementLog.InsulinEntries)
-	exportResp.Result.MeasurementCounts.FoodCount = len(m.DeviceData.MeasurementLog.FoodEntries)
+	return false
+}
 
-	return
+func isAuthStatus(status int) bool {
+	return status == http.StatusUnauthorized || status == http.StatusForbidden
 }
 
+// LastImported returns the timestamp of the last imported scheduled glucose entry
 func (lv *libreview) LastImported() *time.Time {
-	return lv.lastEntryTS
+	return lv.LastImportedAt(ScheduledGlucose)
+}
+
+// LastImportedAt returns the timestamp of the last imported entry of measurement type
+func (lv *libreview) LastImportedAt(measurement string) *time.Time {
+	ts, ok := lv.lastImported[measurement]
+	if !ok {
+		return nil
+	}
+	return &ts
 }
@@ -0,0 +1,92 @@
+package libreview
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// libreViewServer responds to measurements with status and http status of the first response, ok then.
+// Counts auth requests
+func libreViewServer(t *testing.T, httpStatus, status int) (*httptest.Server, *int32) {
+	t.Helper()
+
+	auths := new(int32)
+	posts := new(int32)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/lsl/api/nisperson/getauthentication", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(auths, 1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"status":0,"result":{"UserToken":"new","UserName":"user"}}`))
+	})
+	mux.HandleFunc("/lsl/api/measurements", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if atomic.AddInt32(posts, 1) == 1 {
+			w.WriteHeader(httpStatus)
+			json.NewEncoder(w).Encode(map[string]any{"status": status})
+			return
+		}
+		w.Write([]byte(`{"status":0}`))
+	})
+
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	return srv, auths
+}
+
+func TestImportMeasurementsRejected(t *testing.T) {
+
+	tests := []struct {
+		name       string
+		httpStatus int
+		status     int
+		wantAuths  int32
+		wantErr    bool
+	}{
+		{name: "unauthorized", httpStatus: http.StatusUnauthorized, wantAuths: 1},
+		{name: "forbidden", httpStatus: http.StatusForbidden, wantAuths: 1},
+		{name: "auth status in body", httpStatus: http.StatusOK, status: http.StatusUnauthorized, wantAuths: 1},
+		{name: "other status in body", httpStatus: http.StatusOK, status: 20, wantErr: true},
+		{name: "bad request", httpStatus: http.StatusBadRequest, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, auths := libreViewServer(t, tt.httpStatus, tt.status)
+
+			cache := filepath.Join(t.TempDir(), "session.json")
+			if err := (&Session{UserToken: "cached", UserName: "user"}).Save(cache); err != nil {
+				t.Fatal(err)
+			}
+
+			cfg := &Config{
+				Auth:         Auth{Username: "user"},
+				ImportConfig: ImportConfig{APIEndpoint: srv.URL},
+			}
+			lv, err := NewWithConfig(cfg, WithSessionCache(cache))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := lv.Login(context.Background(), false); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = lv.ImportMeasurements(context.Background(), WithScheduledGlucoseEntries(ScheduledContinuousGlucoseEntries{
+				{RecordNumber: 1, Timestamp: time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)},
+			}))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if got := atomic.LoadInt32(auths); got != tt.wantAuths {
+				t.Fatalf("got %d auth requests, want %d", got, tt.wantAuths)
+			}
+		})
+	}
+}
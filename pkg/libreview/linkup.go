@@ -0,0 +1,294 @@
+package libreview
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/blutz1982/go-nsexporter-libreview/pkg/rest"
+)
+
+const (
+	// LibreLinkUp timestamp layout, e.g. 10/17/2023 9:05:12 AM
+	LinkUpTimeLayout = "1/2/2006 3:04:05 PM"
+
+	linkUpAPIPath = "llu"
+)
+
+// LinkUp is a client for LibreLinkUp (follower) API.
+// It is used to download glucose measurements from LibreView
+type LinkUp interface {
+	Login(ctx context.Context) error
+	Connections(ctx context.Context) ([]*LinkUpConnection, error)
+	// Measurements returns glucose history (scheduled entries) and the last scan (unscheduled entry) of the patient.
+	// LibreLinkUp does not share insulin and food. The first connection is used if patientID is empty
+	Measurements(ctx context.Context, patientID string) (*MeasurementLog, error)
+}
+
+type LinkUpTime struct {
+	time.Time
+}
+
+func (t *LinkUpTime) UnmarshalJSON(b []byte) (err error) {
+	s := strings.Trim(string(b), "\"")
+	if s == "null" || len(s) == 0 {
+		t.Time = time.Time{}
+		return
+	}
+
+	// FactoryTimestamp is UTC
+	t.Time, err = time.Parse(LinkUpTimeLayout, s)
+
+	return
+}
+
+type LinkUpGlucoseItem struct {
+	FactoryTimestamp LinkUpTime `json:"FactoryTimestamp"`
+	Timestamp        LinkUpTime `json:"Timestamp"`
+	ValueInMgPerDl   float64    `json:"ValueInMgPerDl"`
+	TrendArrow       int        `json:"TrendArrow"`
+	IsHigh           bool       `json:"isHigh"`
+	IsLow            bool       `json:"isLow"`
+}
+
+type LinkUpConnection struct {
+	ID                 string             `json:"id"`
+	PatientID          string             `json:"patientId"`
+	FirstName          string             `json:"firstName"`
+	LastName           string             `json:"lastName"`
+	GlucoseMeasurement *LinkUpGlucoseItem `json:"glucoseMeasurement"`
+}
+
+type LinkUpAuthResponse struct {
+	Status int `json:"status"`
+	Data   struct {
+		Redirect bool   `json:"redirect"`
+		Region   string `json:"region"`
+		User     struct {
+			ID string `json:"id"`
+		} `json:"user"`
+		AuthTicket struct {
+			Token   string `json:"token"`
+			Expires int64  `json:"expires"`
+		} `json:"authTicket"`
+	} `json:"data"`
+}
+
+type LinkUpConnectionsResponse struct {
+	Status int                 `json:"status"`
+	Data   []*LinkUpConnection `json:"data"`
+}
+
+type LinkUpGraphResponse struct {
+	Status int `json:"status"`
+	Data   struct {
+		Connection *LinkUpConnection    `json:"connection"`
+		GraphData  []*LinkUpGlucoseItem `json:"graphData"`
+	} `json:"data"`
+}
+
+type linkUpLogin struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+func (l *linkUpLogin) Kind() string {
+	return "LinkUpLogin"
+}
+
+type linkUp struct {
+	config     *Config
+	base       *url.URL
+	client     *http.Client
+	restOpts   []rest.RESTClientOpt
+	token      string
+	accountID  string
+	redirected bool
+}
+
+// NewLinkUpWithConfig returns LibreLinkUp client. Credentials of the follower account are taken from linkUp auth config
+func NewLinkUpWithConfig(config *Config, opts ...ClientOpt) (LinkUp, error) {
+
+	if len(config.LinkUp.Auth.Username) == 0 {
+		return nil, NewLibreViewError(fmt.Errorf("libreview.linkUp.auth is not set"), "linkup config")
+	}
+
+	u, err := url.Parse(config.LinkUp.APIEndpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	// reuse libreview client options (retry, transport)
+	lv := &libreview{
+		transport: http.DefaultTransport.(*http.Transport).Clone(),
+	}
+	for _, opt := range opts {
+		opt(lv)
+	}
+
+	return &linkUp{
+		config:   config,
+		base:     u,
+		client:   &http.Client{Transport: lv.transport},
+		restOpts: lv.restOpts,
+	}, nil
+}
+
+func (l *linkUp) restClient() *rest.RESTClient {
+	return rest.NewRESTClient(l.base, linkUpAPIPath, contentConfig, l.client, l.restOpts...)
+}
+
+func (l *linkUp) request(r *rest.Request) *rest.Request {
+	r = r.SetHeader("product", l.config.LinkUp.Product).
+		SetHeader("version", l.config.LinkUp.Version)
+
+	if len(l.token) > 0 {
+		r = r.SetHeader("Authorization", fmt.Sprintf("Bearer %s", l.token)).
+			SetHeader("account-id", l.accountID)
+	}
+
+	return r
+}
+
+func (l *linkUp) Login(ctx context.Context) error {
+
+	authResp := new(LinkUpAuthResponse)
+
+	result := l.request(l.restClient().Post()).
+		Idempotent().
+		Resource("auth").
+		Name("login").
+		Body(&linkUpLogin{
+			Email:    l.config.LinkUp.Auth.Username,
+			Password: l.config.LinkUp.Auth.Password,
+		}).
+		Do(ctx)
+
+	if err := result.Into(authResp); err != nil {
+		return NewLibreViewError(err, "linkup auth error")
+	}
+
+	// account belongs to another region
+	if authResp.Data.Redirect && len(authResp.Data.Region) > 0 && !l.redirected {
+		l.base.Host = fmt.Sprintf("api-%s.libreview.io", authResp.Data.Region)
+		l.redirected = true
+		return l.Login(ctx)
+	}
+
+	if authResp.Status != 0 || len(authResp.Data.AuthTicket.Token) == 0 {
+		return NewLibreViewError(&StatusError{
+			Status: authResp.Status,
+			Body:   result.Body(),
+		}, "linkup auth error: cant get token")
+	}
+
+	hash := sha256.Sum256([]byte(authResp.Data.User.ID))
+
+	l.token = authResp.Data.AuthTicket.Token
+	l.accountID = hex.EncodeToString(hash[:])
+
+	return nil
+}
+
+func (l *linkUp) Connections(ctx context.Context) ([]*LinkUpConnection, error) {
+	connResp := new(LinkUpConnectionsResponse)
+
+	err := l.request(l.restClient().Get()).
+		Name("connections").
+		Do(ctx).
+		Into(connResp)
+	if err != nil {
+		return nil, NewLibreViewError(err, "cant get linkup connections")
+	}
+
+	return connResp.Data, nil
+}
+
+func (l *linkUp) Measurements(ctx context.Context, patientID string) (*MeasurementLog, error) {
+
+	if len(patientID) == 0 {
+		connections, err := l.Connections(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if len(connections) == 0 {
+			return nil, NewLibreViewError(fmt.Errorf("no connections"), "cant get linkup measurements")
+		}
+		patientID = connections[0].PatientID
+	}
+
+	graphResp := new(LinkUpGraphResponse)
+
+	err := l.request(l.restClient().Get()).
+		Resource("connections").
+		Name(patientID).
+		SubResource("graph").
+		Do(ctx).
+		Into(graphResp)
+	if err != nil {
+		return nil, NewLibreViewError(err, "cant get linkup measurements")
+	}
+
+	result := &MeasurementLog{
+		ScheduledContinuousGlucoseEntries:   ScheduledContinuousGlucoseEntries{},
+		UnscheduledContinuousGlucoseEntries: UnscheduledContinuousGlucoseEntries{},
+	}
+
+	for _, item := range graphResp.Data.GraphData {
+		result.ScheduledContinuousGlucoseEntries.Append(item.ScheduledEntry())
+	}
+
+	if conn := graphResp.Data.Connection; conn != nil && conn.GlucoseMeasurement != nil {
+		result.UnscheduledContinuousGlucoseEntries.Append(conn.GlucoseMeasurement.UnscheduledEntry())
+	}
+
+	return result, nil
+}
+
+// LinkUp trend arrow: 1 - falling quickly, 2 - falling, 3 - stable, 4 - rising, 5 - rising quickly
+var linkUpTrendArrowMap = map[int]string{
+	1: "FallingQuickly",
+	2: "Falling",
+	3: "Stable",
+	4: "Rising",
+	5: "RisingQuickly",
+}
+
+func (i *LinkUpGlucoseItem) ScheduledEntry() *ScheduledContinuousGlucoseEntry {
+	return &ScheduledContinuousGlucoseEntry{
+		ValueInMgPerDl: i.ValueInMgPerDl,
+		ExtendedProperties: ExtendedProperties{
+			FactoryTimestamp: i.FactoryTimestamp.Time,
+			LowOutOfRange:    fmt.Sprint(i.IsLow),
+			HighOutOfRange:   fmt.Sprint(i.IsHigh),
+			CanMerge:         "true",
+		},
+		RecordNumber: RecordNumberIncrement + i.FactoryTimestamp.Unix(),
+		Timestamp:    i.FactoryTimestamp.Time,
+	}
+}
+
+func (i *LinkUpGlucoseItem) UnscheduledEntry() *UnscheduledContinuousGlucoseEntry {
+	trendArrow, ok := linkUpTrendArrowMap[i.TrendArrow]
+	if !ok {
+		trendArrow = "Stable"
+	}
+
+	return &UnscheduledContinuousGlucoseEntry{
+		ValueInMgPerDl: i.ValueInMgPerDl,
+		ExtendedProperties: UnscheduledExtendedProperties{
+			FactoryTimestamp: i.FactoryTimestamp.Time,
+			LowOutOfRange:    fmt.Sprint(i.IsLow),
+			HighOutOfRange:   fmt.Sprint(i.IsHigh),
+			TrendArrow:       trendArrow,
+			IsActionable:     true,
+		},
+		RecordNumber: RecordNumberIncrementUnscheduled + i.FactoryTimestamp.Unix(),
+		Timestamp:    i.FactoryTimestamp.Time,
+	}
+}
@@ -0,0 +1,81 @@
+package libreview
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"strings"
+	"time"
+)
+
+// Session is a LibreView auth session: user token and account identity
+type Session struct {
+	UserToken string    `json:"userToken"`
+	AccountID string    `json:"accountId"`
+	UserName  string    `json:"userName"`
+	FirstName string    `json:"firstName"`
+	LastName  string    `json:"lastName"`
+	Email     string    `json:"email"`
+	Country   string    `json:"country"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func NewSessionFromAuthResponse(r *AuthResponse) *Session {
+	return &Session{
+		UserToken: r.Result.UserToken,
+		AccountID: r.Result.AccountID,
+		UserName:  r.Result.UserName,
+		FirstName: r.Result.FirstName,
+		LastName:  r.Result.LastName,
+		Email:     r.Result.Email,
+		Country:   r.Result.Country,
+		CreatedAt: time.Now().UTC(),
+	}
+}
+
+func (s *Session) Age() time.Duration {
+	return time.Since(s.CreatedAt)
+}
+
+// BelongsTo reports whether session is of the user (username or email)
+func (s *Session) BelongsTo(username string) bool {
+	return strings.EqualFold(s.UserName, username) || strings.EqualFold(s.Email, username)
+}
+
+// LoadSession reads cached session. Not existing file is not an error, nil returned
+func LoadSession(path string) (*Session, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	s := new(Session)
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, err
+	}
+
+	if len(s.UserToken) == 0 {
+		return nil, nil
+	}
+
+	return s, nil
+}
+
+// Save writes session to file readable only by owner
+func (s *Session) Save(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return err
+	}
+
+	// file may exist with other permissions
+	return os.Chmod(path, 0600)
+}
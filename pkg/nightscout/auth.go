@@ -0,0 +1,129 @@
+package nightscout
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/blutz1982/go-nsexporter-libreview/pkg/rest"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// JWT token is refreshed this time before expiration
+	tokenRefreshBefore = time.Minute
+)
+
+type TokenSource func(ctx context.Context) (*TokenResponse, error)
+
+// jwtAuthRoundTripper sets JWT bearer token. The token is refreshed before expiration (exp field)
+// and after 401 response. In the last case the request is retried once
+type jwtAuthRoundTripper struct {
+	mu     sync.Mutex
+	source TokenSource
+	token  string
+	exp    time.Time
+	next   http.RoundTripper
+}
+
+func newJWTAuthRoundTripper(source TokenSource, rt http.RoundTripper) *jwtAuthRoundTripper {
+	return &jwtAuthRoundTripper{
+		source: source,
+		next:   rt,
+	}
+}
+
+// getToken returns valid token. The token is refreshed if it expires soon or equals to stale token
+func (rt *jwtAuthRoundTripper) getToken(ctx context.Context, stale string) (string, error) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	if len(rt.token) > 0 && rt.token != stale && (rt.exp.IsZero() || time.Until(rt.exp) > tokenRefreshBefore) {
+		return rt.token, nil
+	}
+
+	tokenResp, err := rt.source(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	rt.token = tokenResp.Token
+	rt.exp = time.Time{}
+	if tokenResp.Exp > 0 {
+		rt.exp = time.Unix(int64(tokenResp.Exp), 0)
+	}
+
+	log.Debug().
+		Time("exp", rt.exp).
+		Msg("nightscout JWT token refreshed")
+
+	return rt.token, nil
+}
+
+func (rt *jwtAuthRoundTripper) send(req *http.Request, token string) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	return rt.next.RoundTrip(req)
+}
+
+func (rt *jwtAuthRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if len(req.Header.Get("Authorization")) != 0 {
+		return rt.next.RoundTrip(req)
+	}
+
+	token, err := rt.getToken(req.Context(), "")
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := rt.send(req, token)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	// body can not be replayed
+	if req.Body != nil && req.GetBody == nil {
+		return resp, nil
+	}
+
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	token, err = rt.getToken(req.Context(), token)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		req = req.Clone(req.Context())
+		req.Body = body
+	}
+
+	return rt.send(req, token)
+}
+
+// tokenSource returns JWT token source for access token (authorization/request/<token>)
+func tokenSource(restClient rest.Interface, urlToken string) TokenSource {
+	return func(ctx context.Context) (*TokenResponse, error) {
+		tokenResp := new(TokenResponse)
+
+		err := restClient.
+			Get().
+			Resource("authorization/request").
+			Name(urlToken).
+			Do(ctx).
+			Into(tokenResp)
+		if err != nil {
+			return nil, NewNightscoutError(err, "auth error: cant retreive JWT token")
+		}
+
+		return tokenResp, nil
+	}
+}
@@ -0,0 +1,169 @@
+package nightscout
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// authServer responds 401 to the tokens from unauthorized and records the requests
+type authServer struct {
+	mu           sync.Mutex
+	unauthorized map[string]bool
+	tokens       []string
+	bodies       []string
+}
+
+func (s *authServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+	s.mu.Lock()
+	s.tokens = append(s.tokens, token)
+	s.bodies = append(s.bodies, string(body))
+	s.mu.Unlock()
+
+	if s.unauthorized[token] {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// testTokenSource issues tokens t1, t2, ... expiring after exp
+func testTokenSource(exp time.Duration) (TokenSource, *int) {
+	issued := new(int)
+	return func(context.Context) (*TokenResponse, error) {
+		*issued++
+		return &TokenResponse{
+			Token: fmt.Sprintf("t%d", *issued),
+			Exp:   int(time.Now().Add(exp).Unix()),
+		}, nil
+	}, issued
+}
+
+func TestJWTAuthRoundTripper(t *testing.T) {
+
+	tests := []struct {
+		name         string
+		exp          time.Duration
+		unauthorized []string
+		requests     int
+		wantStatus   int
+		wantTokens   []string
+		wantIssued   int
+	}{
+		{
+			name:       "token reused",
+			exp:        time.Hour,
+			requests:   2,
+			wantStatus: http.StatusOK,
+			wantTokens: []string{"t1", "t1"},
+			wantIssued: 1,
+		},
+		{
+			// the token expires sooner than tokenRefreshBefore, it is refreshed before every request
+			name:       "refreshed before exp",
+			exp:        tokenRefreshBefore / 2,
+			requests:   2,
+			wantStatus: http.StatusOK,
+			wantTokens: []string{"t1", "t2"},
+			wantIssued: 2,
+		},
+		{
+			name:       "expired token",
+			exp:        -time.Hour,
+			requests:   2,
+			wantStatus: http.StatusOK,
+			wantTokens: []string{"t1", "t2"},
+			wantIssued: 2,
+		},
+		{
+			name:         "refreshed after 401",
+			exp:          time.Hour,
+			unauthorized: []string{"t1"},
+			requests:     1,
+			wantStatus:   http.StatusOK,
+			wantTokens:   []string{"t1", "t2"},
+			wantIssued:   2,
+		},
+		{
+			// the request is retried once
+			name:         "401 after refresh",
+			exp:          time.Hour,
+			unauthorized: []string{"t1", "t2"},
+			requests:     1,
+			wantStatus:   http.StatusUnauthorized,
+			wantTokens:   []string{"t1", "t2"},
+			wantIssued:   2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &authServer{unauthorized: make(map[string]bool)}
+			for _, token := range tt.unauthorized {
+				s.unauthorized[token] = true
+			}
+			srv := httptest.NewServer(s)
+			defer srv.Close()
+
+			source, issued := testTokenSource(tt.exp)
+			client := &http.Client{Transport: newJWTAuthRoundTripper(source, http.DefaultTransport)}
+
+			var status int
+			for i := 0; i < tt.requests; i++ {
+				resp, err := client.Post(srv.URL, "application/json", strings.NewReader(`{"sgv":100}`))
+				if err != nil {
+					t.Fatal(err)
+				}
+				resp.Body.Close()
+				status = resp.StatusCode
+			}
+
+			if status != tt.wantStatus {
+				t.Errorf("got status %d, want %d", status, tt.wantStatus)
+			}
+			if *issued != tt.wantIssued {
+				t.Errorf("got %d tokens issued, want %d", *issued, tt.wantIssued)
+			}
+			if fmt.Sprint(s.tokens) != fmt.Sprint(tt.wantTokens) {
+				t.Errorf("got tokens %v, want %v", s.tokens, tt.wantTokens)
+			}
+			// the body is replayed on retry
+			for _, body := range s.bodies {
+				if body != `{"sgv":100}` {
+					t.Errorf("got body %q", body)
+				}
+			}
+		})
+	}
+}
+
+func TestJWTAuthRoundTripperAuthorizationSet(t *testing.T) {
+
+	s := &authServer{}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	source, issued := testTokenSource(time.Hour)
+	client := &http.Client{Transport: newJWTAuthRoundTripper(source, http.DefaultTransport)}
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	req.Header.Set("Authorization", "Bearer own")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if *issued != 0 || len(s.tokens) != 1 || s.tokens[0] != "own" {
+		t.Fatalf("got tokens %v, %d issued", s.tokens, *issued)
+	}
+}
@@ -15,10 +15,14 @@ const (
 	Insulin = "insulin"
 	Carbs   = "carbs"
 	Sgv     = "sgv"
+	Mbg     = "mbg"
+	// treatments with glucose value (e.g. BG Check)
+	Glucose = "glucose"
 
 	DefaultMaxSVG      = 400
 	DefaultMinSVG      = 40
 	MaxEnties          = 131072
+	DefaultPageSize    = 1000
 	versionedAPIPathV1 = "api/v1"
 	versionedAPIPathV2 = "api/v2"
 )
@@ -32,7 +36,28 @@ type ListOptions struct {
 	Kind     string
 	DateFrom time.Time
 	DateTo   time.Time
-	Count    int
+	// Count is max count of entries in result. 0 means no limit
+	Count int
+	// PageSize is count of entries per API request. DefaultPageSize if not set
+	PageSize int
+}
+
+// pageCount returns count of entries for next page request or 0 if the limit is reached
+func (o ListOptions) pageCount(received int) int {
+	count := o.PageSize
+	if count <= 0 {
+		count = DefaultPageSize
+	}
+
+	if o.Count > 0 && o.Count-received < count {
+		count = o.Count - received
+	}
+
+	if count < 0 {
+		return 0
+	}
+
+	return count
 }
 
 type Client interface {
@@ -71,58 +96,90 @@ func NewNightscoutError(err error, info string) error {
 	}
 }
 
-func NewJWTToken(ctx context.Context, baseUrl string, urlToken string) (string, error) {
+func NewJWTToken(ctx context.Context, baseUrl string, urlToken string, opts ...rest.RESTClientOpt) (string, error) {
 	u, err := url.Parse(baseUrl)
 	if err != nil {
 		return "", err
 	}
 
-	tokenResp := new(TokenResponse)
-
-	err = rest.NewRESTClient(u, versionedAPIPathV2, contentConfig, http.DefaultClient).
-		Get().
-		Resource("authorization/request").
-		Name(urlToken).
-		Do(ctx).
-		Into(tokenResp)
+	tokenResp, err := tokenSource(rest.NewRESTClient(u, versionedAPIPathV2, contentConfig, http.DefaultClient, opts...), urlToken)(ctx)
 	if err != nil {
-		return "", NewNightscoutError(err, "auth error: cant retreive JWT token")
+		return "", err
 	}
 
 	return tokenResp.Token, nil
 }
 
-func NewWithJWTToken(baseUrl, JWTToken string) (Client, error) {
+// NewWithAPIToken returns client authorized with access token.
+// JWT token is requested immediately and refreshed automatically
+func NewWithAPIToken(ctx context.Context, baseUrl, apiToken string, opts ...rest.RESTClientOpt) (Client, error) {
+
+	u, err := url.Parse(baseUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := newJWTClient(ctx, u, apiToken, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &nightscout{
+		restClient: rest.NewRESTClient(u, versionedAPIPathV1, contentConfig, client, opts...),
+	}, nil
+}
+
+// newJWTClient returns http client with JWT auth transport. The token is requested immediately
+func newJWTClient(ctx context.Context, u *url.URL, apiToken string, opts ...rest.RESTClientOpt) (*http.Client, error) {
+
+	transport := newJWTAuthRoundTripper(
+		tokenSource(rest.NewRESTClient(u, versionedAPIPathV2, contentConfig, http.DefaultClient, opts...), apiToken),
+		http.DefaultTransport.(*http.Transport).Clone(),
+	)
+
+	// fail early on bad token
+	if _, err := transport.getToken(ctx, ""); err != nil {
+		return nil, err
+	}
+
+	return &http.Client{
+		Transport: transport,
+	}, nil
+}
+
+func NewWithJWTToken(baseUrl, JWTToken string, opts ...rest.RESTClientOpt) (Client, error) {
 
 	u, err := url.Parse(baseUrl)
 	if err != nil {
 		return nil, err
 	}
 
-	client := http.DefaultClient
-	client.Transport = rest.NewBearerAuthRoundTripper(JWTToken, http.DefaultTransport.(*http.Transport).Clone())
+	client := &http.Client{
+		Transport: rest.NewBearerAuthRoundTripper(JWTToken, http.DefaultTransport.(*http.Transport).Clone()),
+	}
 
 	return &nightscout{
-		restClient: rest.NewRESTClient(u, versionedAPIPathV1, contentConfig, client),
+		restClient: rest.NewRESTClient(u, versionedAPIPathV1, contentConfig, client, opts...),
 	}, nil
 }
 
-func NewWithAPISecret(baseUrl, apiSecret string) (Client, error) {
+func NewWithAPISecret(baseUrl, apiSecret string, opts ...rest.RESTClientOpt) (Client, error) {
 
 	u, err := url.Parse(baseUrl)
 	if err != nil {
 		return nil, err
 	}
 
-	client := http.DefaultClient
-	client.Transport = rest.NewAPISecretAuthRoundTripper(apiSecret, http.DefaultTransport.(*http.Transport).Clone())
+	client := &http.Client{
+		Transport: rest.NewAPISecretAuthRoundTripper(apiSecret, http.DefaultTransport.(*http.Transport).Clone()),
+	}
 
 	return &nightscout{
-		restClient: rest.NewRESTClient(u, versionedAPIPathV1, contentConfig, client),
+		restClient: rest.NewRESTClient(u, versionedAPIPathV1, contentConfig, client, opts...),
 	}, nil
 }
 
-func New(baseUrl string) (Client, error) {
+func New(baseUrl string, opts ...rest.RESTClientOpt) (Client, error) {
 
 	u, err := url.Parse(baseUrl)
 	if err != nil {
@@ -130,7 +187,7 @@ func New(baseUrl string) (Client, error) {
 	}
 
 	return &nightscout{
-		restClient: rest.NewRESTClient(u, versionedAPIPathV1, contentConfig, http.DefaultClient),
+		restClient: rest.NewRESTClient(u, versionedAPIPathV1, contentConfig, http.DefaultClient, opts...),
 	}, nil
 }
 
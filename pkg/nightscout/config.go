@@ -4,4 +4,6 @@ type Config struct {
 	URL       string `yaml:"url"`
 	APIToken  string `yaml:"apiToken"`
 	APISecret string `yaml:"apiSecret"`
+	// APIVersion is v1 (default) or v3
+	APIVersion string `yaml:"apiVersion"`
 }
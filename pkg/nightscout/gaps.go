@@ -0,0 +1,108 @@
+package nightscout
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// Gap is a period without readings between two consecutive readings
+type Gap struct {
+	// From is the time of the last reading before the gap
+	From time.Time
+	// To is the time of the first reading after the gap
+	To time.Time
+}
+
+func (g Gap) Duration() time.Duration {
+	return g.To.Sub(g.From)
+}
+
+// NotInterpolated skips readings filled by Interpolate
+func NotInterpolated() GlucoseFilterFunc {
+	return func(e *GlucoseEntry) bool {
+		return !e.Interpolated
+	}
+}
+
+// sorted returns entries with date, newest first (as Nightscout returns them)
+func (es GlucoseEntries) sorted() GlucoseEntries {
+	result := make(GlucoseEntries, 0, len(es))
+	for _, e := range es {
+		if e.Date != nil {
+			result = append(result, e)
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Date.Time().After(result[j].Date.Time())
+	})
+	return result
+}
+
+// Latest returns the newest entry or nil
+func (es GlucoseEntries) Latest() *GlucoseEntry {
+	sorted := es.sorted()
+	if len(sorted) == 0 {
+		return nil
+	}
+	return sorted[0]
+}
+
+// Gaps returns gaps longer than threshold in ascending order
+func (es GlucoseEntries) Gaps(threshold time.Duration) (result []Gap) {
+	sorted := es.sorted()
+	for i := len(sorted) - 1; i > 0; i-- {
+		gap := Gap{
+			From: sorted[i].Date.Time(),
+			To:   sorted[i-1].Date.Time(),
+		}
+		if gap.Duration() > threshold {
+			result = append(result, gap)
+		}
+	}
+	return
+}
+
+// Interpolate fills gaps longer than step and not longer than maxGap with readings every step.
+// Sgv of the filled readings is linear between the readings around the gap, the readings are marked Interpolated.
+// Returns entries newest first and the count of filled readings
+func (es *GlucoseEntries) Interpolate(step, maxGap time.Duration) (*GlucoseEntries, int) {
+
+	sorted := es.sorted()
+	result := make(GlucoseEntries, 0, len(sorted))
+	filled := 0
+
+	for i, newer := range sorted {
+		result = append(result, newer)
+
+		if i == len(sorted)-1 || step <= 0 {
+			continue
+		}
+
+		older := sorted[i+1]
+		from, to := older.Date.Time(), newer.Date.Time()
+		gap := to.Sub(from)
+		if gap <= step || gap > maxGap {
+			continue
+		}
+
+		// newest first, a filled reading is not closer than step/2 to the next real one
+		for ts := to.Add(-step); ts.Sub(from) >= step/2; ts = ts.Add(-step) {
+			ratio := float64(ts.Sub(from)) / float64(gap)
+			date := NSTime(ts)
+			result = append(result, &GlucoseEntry{
+				Type:         Sgv,
+				Device:       older.Device,
+				Date:         &date,
+				DateString:   ts.UTC(),
+				SysTime:      ts.UTC(),
+				Sgv:          SVG(math.Round(float64(older.Sgv) + (float64(newer.Sgv)-float64(older.Sgv))*ratio)),
+				Direction:    "NONE",
+				Interpolated: true,
+			})
+			filled++
+		}
+	}
+
+	return &result, filled
+}
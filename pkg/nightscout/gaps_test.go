@@ -0,0 +1,135 @@
+package nightscout
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+var gapsBase = time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+
+// readingsAt returns sgv readings at minutes after gapsBase, newest first like Nightscout
+func readingsAt(values map[int]float64) (result GlucoseEntries) {
+	for m, sgv := range values {
+		date := NSTime(gapsBase.Add(time.Duration(m) * time.Minute))
+		result = append(result, &GlucoseEntry{Date: &date, Sgv: SVG(sgv), Type: Sgv})
+	}
+	return result.sorted()
+}
+
+// at returns minutes after gapsBase
+func at(ts time.Time) int {
+	return int(ts.Sub(gapsBase) / time.Minute)
+}
+
+func TestGaps(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		readings  map[int]float64
+		threshold time.Duration
+		want      [][2]int
+	}{
+		{name: "no gaps", readings: map[int]float64{0: 100, 5: 100, 10: 100}, threshold: 20 * time.Minute},
+		{name: "gap", readings: map[int]float64{0: 100, 5: 100, 40: 100, 45: 100}, threshold: 20 * time.Minute, want: [][2]int{{5, 40}}},
+		{name: "threshold is not a gap", readings: map[int]float64{0: 100, 20: 100}, threshold: 20 * time.Minute},
+		{name: "ascending", readings: map[int]float64{0: 100, 30: 100, 35: 100, 90: 100}, threshold: 20 * time.Minute, want: [][2]int{{0, 30}, {35, 90}}},
+		{name: "one reading", readings: map[int]float64{0: 100}, threshold: time.Minute},
+		{name: "empty", threshold: time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got [][2]int
+			for _, gap := range readingsAt(tt.readings).Gaps(tt.threshold) {
+				got = append(got, [2]int{at(gap.From), at(gap.To)})
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInterpolate(t *testing.T) {
+
+	type reading struct {
+		minute       int
+		sgv          float64
+		interpolated bool
+	}
+
+	tests := []struct {
+		name     string
+		readings map[int]float64
+		maxGap   time.Duration
+		want     []reading
+	}{
+		{
+			name:     "no gap",
+			readings: map[int]float64{0: 100, 5: 110},
+			maxGap:   time.Hour,
+			want:     []reading{{5, 110, false}, {0, 100, false}},
+		},
+		{
+			name:     "linear",
+			readings: map[int]float64{0: 100, 20: 140},
+			maxGap:   time.Hour,
+			want:     []reading{{20, 140, false}, {15, 130, true}, {10, 120, true}, {5, 110, true}, {0, 100, false}},
+		},
+		{
+			// a filled reading is not closer than step/2 to the older reading
+			name:     "not aligned",
+			readings: map[int]float64{0: 100, 12: 100},
+			maxGap:   time.Hour,
+			want:     []reading{{12, 100, false}, {7, 100, true}, {0, 100, false}},
+		},
+		{
+			name:     "gap longer than max",
+			readings: map[int]float64{0: 100, 61: 200},
+			maxGap:   time.Hour,
+			want:     []reading{{61, 200, false}, {0, 100, false}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries := readingsAt(tt.readings)
+			result, filled := entries.Interpolate(5*time.Minute, tt.maxGap)
+
+			var got []reading
+			wantFilled := 0
+			for _, e := range *result {
+				got = append(got, reading{at(e.Date.Time()), e.Sgv.Float64(), e.Interpolated})
+			}
+			for _, r := range tt.want {
+				if r.interpolated {
+					wantFilled++
+				}
+			}
+
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			if filled != wantFilled {
+				t.Fatalf("got %d filled, want %d", filled, wantFilled)
+			}
+			if measured := result.Filter(NotInterpolated()); measured.Len() != entries.Len() {
+				t.Fatalf("got %d real readings, want %d", measured.Len(), entries.Len())
+			}
+		})
+	}
+}
+
+func TestLatest(t *testing.T) {
+
+	if got := (GlucoseEntries{}).Latest(); got != nil {
+		t.Fatalf("got %v, want nil", got)
+	}
+
+	entries := readingsAt(map[int]float64{5: 100, 15: 120, 10: 110})
+	slices.Reverse(entries)
+	if got := entries.Latest(); at(got.Date.Time()) != 15 {
+		t.Fatalf("got %d, want 15", at(got.Date.Time()))
+	}
+}
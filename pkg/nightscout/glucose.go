@@ -2,6 +2,7 @@ package nightscout
 
 import (
 	"context"
+	"errors"
 	"strconv"
 	"time"
 
@@ -14,6 +15,10 @@ type GlucoseGetter interface {
 
 type GlucoseInterface interface {
 	List(ctx context.Context, opts ListOptions) (*GlucoseEntries, error)
+	Iterate(ctx context.Context, opts ListOptions, fn VisitorFunc) error
+	Create(ctx context.Context, entries GlucoseEntries) (result GlucoseEntries, err error)
+	Delete(ctx context.Context, id string) error
+	DeleteMatching(ctx context.Context, opts ListOptions) error
 }
 
 type glucose struct {
@@ -29,19 +34,149 @@ func newGlucose(c Client) *glucose {
 
 func (g glucose) List(ctx context.Context, opts ListOptions) (result *GlucoseEntries, err error) {
 	result = &GlucoseEntries{}
-	r := g.client.Get().
+	err = g.Iterate(ctx, opts, func(e *GlucoseEntry, _ error) error {
+		result.Append(e)
+		return nil
+	})
+	return
+}
+
+// Iterate pages through entries (newest first) and calls fn for each entry.
+// After each page the find[date][$lte] bound is moved to the oldest received entry.
+// Entries of one timestamp are received once if they all fit into a page
+func (g glucose) Iterate(ctx context.Context, opts ListOptions, fn VisitorFunc) error {
+
+	var (
+		received int
+		dateTo   = opts.DateTo
+		// entries of the page boundary, they will be received again
+		seen = make(map[string]struct{})
+	)
+
+	for {
+		count := opts.pageCount(received)
+		if count == 0 {
+			return nil
+		}
+
+		page := &GlucoseEntries{}
+		err := g.client.Get().
+			Resource("entries").
+			Name(opts.Kind).
+			Param("find[date][$gte]", strconv.FormatInt(opts.DateFrom.UTC().UnixMilli(), 10)).
+			Param("find[date][$lte]", strconv.FormatInt(dateTo.UTC().UnixMilli(), 10)).
+			Param("count", strconv.Itoa(count)).
+			Do(ctx).
+			Into(page)
+		if err != nil {
+			return NewNightscoutError(err, "cant retreive list glucose entries")
+		}
+
+		fresh := 0
+		oldest := dateTo
+		for _, e := range *page {
+			if e.Date != nil && e.Date.Time().Before(oldest) {
+				oldest = e.Date.Time()
+			}
+
+			if _, ok := seen[e.ID]; ok {
+				continue
+			}
+
+			fresh++
+			received++
+			if err := fn(e, nil); err != nil {
+				return err
+			}
+		}
+
+		if page.Len() < count {
+			return nil
+		}
+
+		seen = make(map[string]struct{})
+
+		// the whole page is boundary entries (e.g. more than page size entries of one timestamp),
+		// move the bound past the timestamp
+		if fresh == 0 {
+			dateTo = oldest.Add(-time.Millisecond)
+			continue
+		}
+
+		page.Visit(func(e *GlucoseEntry, _ error) error {
+			if e.Date != nil && e.Date.Time().Equal(oldest) {
+				seen[e.ID] = struct{}{}
+			}
+			return nil
+		})
+
+		dateTo = oldest
+	}
+}
+
+// Create posts entries in one batch request
+func (g glucose) Create(ctx context.Context, entries GlucoseEntries) (result GlucoseEntries, err error) {
+
+	body := make(glucoseEntriesCreate, 0, entries.Len())
+	entries.Visit(func(e *GlucoseEntry, _ error) error {
+		body = append(body, newGlucoseEntryCreate(e))
+		return nil
+	})
+
+	err = g.client.Post().
+		Name("entries").
+		Body(&body).
+		Do(ctx).
+		Into(&result)
+
+	if err != nil {
+		return result, NewNightscoutError(err, "cant create glucose entries")
+	}
+
+	return
+}
+
+// Delete removes entry by ID
+func (g glucose) Delete(ctx context.Context, id string) error {
+	err := g.client.Delete().
 		Resource("entries").
-		Name(opts.Kind).
+		Name(id).
+		Do(ctx).
+		Error()
+
+	if err != nil {
+		return NewNightscoutError(err, "cant delete glucose entry")
+	}
+
+	return nil
+}
+
+// DeleteMatching removes all entries of opts.Kind between opts.DateFrom and opts.DateTo.
+// Both dates are required
+func (g glucose) DeleteMatching(ctx context.Context, opts ListOptions) error {
+
+	if opts.DateFrom.IsZero() || opts.DateTo.IsZero() {
+		return NewNightscoutError(errors.New("date range is required"), "cant delete glucose entries")
+	}
+
+	req := g.client.Delete().
+		Resource("entries")
+
+	if len(opts.Kind) > 0 {
+		req = req.Param("find[type]", opts.Kind)
+	}
+
+	err := req.
 		Param("find[date][$gte]", strconv.FormatInt(opts.DateFrom.UTC().UnixMilli(), 10)).
 		Param("find[date][$lte]", strconv.FormatInt(opts.DateTo.UTC().UnixMilli(), 10)).
-		Param("count", strconv.Itoa(opts.Count))
+		Do(ctx).
+		Error()
 
-	err = r.Do(ctx).Into(result)
 	if err != nil {
-		return result, NewNightscoutError(err, "cant retreive list glucose entries")
+		return NewNightscoutError(err, "cant delete glucose entries")
 	}
 
-	return
+	return nil
 }
 
 type SVG float64
@@ -101,6 +236,7 @@ type GlucoseEntry struct {
 	CreatedAt    string    `json:"created_at"`
 	DateString   time.Time `json:"dateString"`
 	Sgv          SVG       `json:"sgv"`
+	Mbg          SVG       `json:"mbg,omitempty"`
 	Delta        float64   `json:"delta"`
 	Direction    string    `json:"direction"`
 	Type         string    `json:"type"`
@@ -115,12 +251,64 @@ type GlucoseEntry struct {
 	UtcOffset    int       `json:"utcOffset"`
 	Subject      string    `json:"subject"`
 	Mills        int64     `json:"mills"`
+	// API v3 fields
+	Identifier  string `json:"identifier,omitempty"`
+	SrvModified int64  `json:"srvModified,omitempty"`
+	IsValid     *bool  `json:"isValid,omitempty"`
+	// Interpolated is set for readings filled in a gap (see GlucoseEntries.Interpolate)
+	Interpolated bool `json:"-"`
 }
 
 func (g *GlucoseEntry) Kind() string {
 	return "GlucoseEntry"
 }
 
+// Identity returns API v3 identifier or _id for documents created with API v1
+func (g *GlucoseEntry) Identity() string {
+	if len(g.Identifier) > 0 {
+		return g.Identifier
+	}
+	return g.ID
+}
+
+// Deleted reports whether entry is deleted (API v3 history)
+func (g *GlucoseEntry) Deleted() bool {
+	return g.IsValid != nil && !*g.IsValid
+}
+
+// glucoseEntryCreate is a glucose entry for create request (without _id and server side fields)
+type glucoseEntryCreate struct {
+	Type       string    `json:"type"`
+	Sgv        SVG       `json:"sgv,omitempty"`
+	Mbg        SVG       `json:"mbg,omitempty"`
+	Date       int64     `json:"date"`
+	DateString time.Time `json:"dateString"`
+	Direction  string    `json:"direction,omitempty"`
+	Device     string    `json:"device,omitempty"`
+	UtcOffset  int       `json:"utcOffset"`
+}
+
+func newGlucoseEntryCreate(e *GlucoseEntry) *glucoseEntryCreate {
+	ts := e.Date.Time()
+	_, offset := ts.Local().Zone()
+	return &glucoseEntryCreate{
+		Type:       e.Type,
+		Sgv:        e.Sgv,
+		Mbg:        e.Mbg,
+		Date:       ts.UnixMilli(),
+		DateString: ts.UTC(),
+		Direction:  e.Direction,
+		Device:     e.Device,
+		UtcOffset:  offset / 60,
+	}
+}
+
+type glucoseEntriesCreate []*glucoseEntryCreate
+
+func (c *glucoseEntriesCreate) Kind() string {
+	return "GlucoseEntries"
+}
+
 type GlucoseEntries []*GlucoseEntry
 
 func (r *GlucoseEntries) Append(e *GlucoseEntry) {
@@ -131,6 +319,23 @@ func (r GlucoseEntries) Len() int {
 	return len(r)
 }
 
+// Near reports whether there is an entry within window around ts
+func (r GlucoseEntries) Near(ts time.Time, window time.Duration) bool {
+	for _, e := range r {
+		if e.Date == nil {
+			continue
+		}
+		d := e.Date.Time().Sub(ts)
+		if d < 0 {
+			d = -d
+		}
+		if d <= window {
+			return true
+		}
+	}
+	return false
+}
+
 type GlucoseFilterFunc func(*GlucoseEntry) bool
 
 func OnlyAfter(date time.Time) GlucoseFilterFunc {
@@ -139,6 +344,20 @@ func OnlyAfter(date time.Time) GlucoseFilterFunc {
 	}
 }
 
+// NotBefore keeps entries at date or later
+func NotBefore(date time.Time) GlucoseFilterFunc {
+	return func(e *GlucoseEntry) bool {
+		return !e.Date.Time().Before(date)
+	}
+}
+
+// NotFromDevice skips entries of device (e.g. imported from LibreView)
+func NotFromDevice(device string) GlucoseFilterFunc {
+	return func(e *GlucoseEntry) bool {
+		return e.Device != device
+	}
+}
+
 func (es *GlucoseEntries) Filter(fn GlucoseFilterFunc) (result *GlucoseEntries) {
 	result = &GlucoseEntries{}
 	es.Visit(func(e *GlucoseEntry, _ error) error {
@@ -0,0 +1,126 @@
+package nightscout
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// entriesServer serves entries like Nightscout API v1: find[date] bounds, newest first, count limit
+func entriesServer(t *testing.T, entries GlucoseEntries) *httptest.Server {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		from, _ := strconv.ParseInt(q.Get("find[date][$gte]"), 10, 64)
+		to, _ := strconv.ParseInt(q.Get("find[date][$lte]"), 10, 64)
+		count, _ := strconv.Atoi(q.Get("count"))
+
+		var page GlucoseEntries
+		for _, e := range entries {
+			ms := e.Date.Time().UnixMilli()
+			if ms >= from && ms <= to {
+				page = append(page, e)
+			}
+		}
+		sort.SliceStable(page, func(i, j int) bool {
+			return page[i].Date.Time().After(page[j].Date.Time())
+		})
+		if len(page) > count {
+			page = page[:count]
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(page); err != nil {
+			t.Error(err)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func testEntries(base time.Time, minutes ...int) (result GlucoseEntries) {
+	for i, m := range minutes {
+		date := NSTime(base.Add(time.Duration(m) * time.Minute))
+		result = append(result, &GlucoseEntry{
+			ID:   fmt.Sprintf("e%02d", i),
+			Date: &date,
+			Sgv:  SVG(100 + i),
+			Type: Sgv,
+		})
+	}
+	return
+}
+
+func TestGlucoseIterate(t *testing.T) {
+
+	base := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		minutes  []int
+		pageSize int
+		count    int
+		want     int
+	}{
+		{name: "single page", minutes: []int{0, 5, 10}, pageSize: 10, want: 3},
+		{name: "several pages", minutes: []int{0, 5, 10, 15, 20, 25, 30}, pageSize: 3, want: 7},
+		{name: "page size 1", minutes: []int{0, 5, 10, 15}, pageSize: 1, want: 4},
+		{name: "count limit", minutes: []int{0, 5, 10, 15, 20, 25, 30}, pageSize: 3, count: 4, want: 4},
+		{name: "duplicate timestamps on page boundary", minutes: []int{0, 5, 5, 5, 10, 15}, pageSize: 3, want: 6},
+		// more entries of one timestamp than page size: the rest of the timestamp is skipped, older entries are not lost
+		{name: "timestamp larger than page", minutes: []int{0, 5, 10, 10, 10, 10, 15}, pageSize: 2, want: 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries := testEntries(base, tt.minutes...)
+			srv := entriesServer(t, entries)
+
+			client, err := New(srv.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := client.Glucose().List(context.Background(), ListOptions{
+				Kind:     Sgv,
+				DateFrom: base,
+				DateTo:   base.Add(time.Hour),
+				PageSize: tt.pageSize,
+				Count:    tt.count,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got.Len() != tt.want {
+				t.Fatalf("got %d entries, want %d", got.Len(), tt.want)
+			}
+
+			ids := make(map[string]struct{})
+			var prev time.Time
+			for _, e := range *got {
+				if _, ok := ids[e.ID]; ok {
+					t.Errorf("entry %s received twice", e.ID)
+				}
+				ids[e.ID] = struct{}{}
+				if !prev.IsZero() && e.Date.Time().After(prev) {
+					t.Errorf("entry %s is out of order", e.ID)
+				}
+				prev = e.Date.Time()
+			}
+
+			// the oldest entry is always received
+			if tt.count == 0 && !(*got)[got.Len()-1].Date.Time().Equal(base) {
+				t.Errorf("oldest entry %s is lost", (*got)[got.Len()-1].ID)
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package nightscout
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	// insulin action class
+	InsulinActionRapid = "rapid"
+	InsulinActionLong  = "long"
+	InsulinActionMixed = "mixed"
+)
+
+// InsulinType is an insulin catalog item
+type InsulinType struct {
+	Name string `yaml:"name"`
+	// Action is rapid, long or mixed
+	Action string `yaml:"action"`
+	// Aliases are other names of the insulin (e.g. INN or brand in other countries)
+	Aliases []string `yaml:"aliases"`
+}
+
+func (i *InsulinType) String() string {
+	return i.Name
+}
+
+func (i *InsulinType) IsLongActing() bool {
+	return i.Action == InsulinActionLong
+}
+
+func DefaultInsulinTypes() []InsulinType {
+	return []InsulinType{
+		{Name: "Fiasp", Action: InsulinActionRapid},
+		{Name: "Novorapid", Action: InsulinActionRapid, Aliases: []string{"NovoLog", "Aspart"}},
+		{Name: "Humalog", Action: InsulinActionRapid},
+		{Name: "Lispro", Action: InsulinActionRapid, Aliases: []string{"Admelog"}},
+		{Name: "Lyumjev", Action: InsulinActionRapid},
+		{Name: "Apidra", Action: InsulinActionRapid, Aliases: []string{"Glulisine"}},
+		{Name: "Actrapid", Action: InsulinActionRapid, Aliases: []string{"Actapid", "Humulin R"}},
+		{Name: "Lantus", Action: InsulinActionLong, Aliases: []string{"Glargine"}},
+		{Name: "Toujeo", Action: InsulinActionLong},
+		{Name: "Basaglar", Action: InsulinActionLong, Aliases: []string{"Abasaglar", "Semglee"}},
+		{Name: "Tresiba", Action: InsulinActionLong, Aliases: []string{"Degludec"}},
+		{Name: "Levemir", Action: InsulinActionLong, Aliases: []string{"Detemir"}},
+		{Name: "Protaphane", Action: InsulinActionLong, Aliases: []string{"Insulatard", "Humulin N", "NPH"}},
+		{Name: "NovoMix", Action: InsulinActionMixed, Aliases: []string{"NovoLog Mix"}},
+		{Name: "Humalog Mix", Action: InsulinActionMixed},
+		{Name: "Ryzodeg", Action: InsulinActionMixed},
+	}
+}
+
+type insulinName struct {
+	re      *regexp.Regexp
+	insulin *InsulinType
+}
+
+// InsulinCatalog classifies insulins by name or alias (case insensitive)
+type InsulinCatalog struct {
+	byName map[string]*InsulinType
+	// longest names first, so "Humalog Mix" wins over "Humalog"
+	names []insulinName
+}
+
+// NewInsulinCatalog checks and indexes insulins. The insulins are added to DefaultInsulinTypes,
+// an insulin overrides the default insulin with the same name or alias
+func NewInsulinCatalog(insulins []InsulinType) (*InsulinCatalog, error) {
+
+	c := &InsulinCatalog{
+		byName: make(map[string]*InsulinType),
+	}
+
+	for i := range insulins {
+		if err := c.add(&insulins[i], i, false); err != nil {
+			return nil, err
+		}
+	}
+
+	defaults := DefaultInsulinTypes()
+	for i := range defaults {
+		if err := c.add(&defaults[i], i, true); err != nil {
+			return nil, err
+		}
+	}
+
+	sort.SliceStable(c.names, func(i, j int) bool {
+		return len(c.names[i].re.String()) > len(c.names[j].re.String())
+	})
+
+	return c, nil
+}
+
+// add indexes the insulin by name and aliases. Names already in the catalog are skipped for the default insulin
+func (c *InsulinCatalog) add(insulin *InsulinType, i int, isDefault bool) error {
+
+	if len(insulin.Name) == 0 {
+		return fmt.Errorf("insulin catalog: empty name of insulin #%d", i)
+	}
+
+	switch insulin.Action {
+	case InsulinActionRapid, InsulinActionLong, InsulinActionMixed:
+	default:
+		return fmt.Errorf("insulin catalog: bad action %q of %s, expected rapid, long or mixed", insulin.Action, insulin.Name)
+	}
+
+	// the default insulin is overridden by name
+	if _, ok := c.byName[strings.ToLower(strings.TrimSpace(insulin.Name))]; ok && isDefault {
+		return nil
+	}
+
+	for _, name := range append([]string{insulin.Name}, insulin.Aliases...) {
+		key := strings.ToLower(strings.TrimSpace(name))
+		if len(key) == 0 {
+			continue
+		}
+		if _, ok := c.byName[key]; ok {
+			if isDefault {
+				continue
+			}
+			return fmt.Errorf("insulin catalog: duplicate name %q", name)
+		}
+		c.byName[key] = insulin
+		c.names = append(c.names, insulinName{
+			re:      regexp.MustCompile(`(?i)\b` + regexp.QuoteMeta(key) + `\b`),
+			insulin: insulin,
+		})
+	}
+
+	return nil
+}
+
+// ParseInsulinType returns insulin by name or alias
+func (c *InsulinCatalog) ParseInsulinType(value string) (*InsulinType, error) {
+	insulin, ok := c.byName[strings.ToLower(strings.TrimSpace(value))]
+	if !ok {
+		return nil, fmt.Errorf("parse error: unknown insulin type %s", value)
+	}
+	return insulin, nil
+}
+
+// Find returns the catalog insulin mentioned in s (e.g. insulinInjections of a treatment)
+func (c *InsulinCatalog) Find(s string) (*InsulinType, bool) {
+	for _, n := range c.names {
+		if n.re.MatchString(s) {
+			return n.insulin, true
+		}
+	}
+	return nil, false
+}
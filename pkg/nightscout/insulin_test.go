@@ -0,0 +1,74 @@
+package nightscout
+
+import "testing"
+
+func TestInsulinCatalogFind(t *testing.T) {
+
+	catalog, err := NewInsulinCatalog([]InsulinType{
+		{Name: "Semglee", Action: InsulinActionLong},
+		{Name: "Humalog", Action: InsulinActionMixed, Aliases: []string{"Humalog 25"}},
+		{Name: "Afrezza", Action: InsulinActionRapid},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		s          string
+		want       string
+		wantAction string
+		wantOK     bool
+	}{
+		{name: "name", s: "Tresiba", want: "Tresiba", wantAction: InsulinActionLong, wantOK: true},
+		{name: "case insensitive", s: "lantus", want: "Lantus", wantAction: InsulinActionLong, wantOK: true},
+		{name: "alias", s: "Degludec", want: "Tresiba", wantAction: InsulinActionLong, wantOK: true},
+		{name: "free text", s: "Lantus 10u", want: "Lantus", wantAction: InsulinActionLong, wantOK: true},
+		{name: "longest name first", s: "Humalog Mix 12", want: "Humalog Mix", wantAction: InsulinActionMixed, wantOK: true},
+		{name: "whole words", s: "Novorapidus"},
+		{name: "unknown", s: "Insulin"},
+		{name: "empty", s: ""},
+		{name: "config insulin", s: "Afrezza", want: "Afrezza", wantAction: InsulinActionRapid, wantOK: true},
+		{name: "config insulin overrides default alias", s: "Semglee", want: "Semglee", wantAction: InsulinActionLong, wantOK: true},
+		{name: "config insulin overrides default name", s: "Humalog", want: "Humalog", wantAction: InsulinActionMixed, wantOK: true},
+		{name: "default alias of overridden name", s: "Basaglar", want: "Basaglar", wantAction: InsulinActionLong, wantOK: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := catalog.Find(tt.s)
+			if ok != tt.wantOK {
+				t.Fatalf("got %v, want %v", ok, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if got.Name != tt.want || got.Action != tt.wantAction {
+				t.Fatalf("got %s (%s), want %s (%s)", got.Name, got.Action, tt.want, tt.wantAction)
+			}
+		})
+	}
+}
+
+func TestNewInsulinCatalogErrors(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		insulins []InsulinType
+	}{
+		{name: "empty name", insulins: []InsulinType{{Action: InsulinActionRapid}}},
+		{name: "bad action", insulins: []InsulinType{{Name: "Fiasp", Action: "fast"}}},
+		{name: "duplicate name", insulins: []InsulinType{
+			{Name: "Semglee", Action: InsulinActionLong},
+			{Name: "Rezvoglar", Action: InsulinActionLong, Aliases: []string{"semglee"}},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewInsulinCatalog(tt.insulins); err == nil {
+				t.Fatal("error expected")
+			}
+		})
+	}
+}
@@ -0,0 +1,184 @@
+package nightscout
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/blutz1982/go-nsexporter-libreview/pkg/socketio"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	listenerMinReconnectDelay = time.Second
+	listenerMaxReconnectDelay = time.Minute
+	listenerAuthTimeout       = 30 * time.Second
+)
+
+// DataUpdate is a payload of the real-time dataUpdate event.
+// Only the presence of records is used, so they are not decoded
+type DataUpdate struct {
+	Delta       bool              `json:"delta"`
+	LastUpdated int64             `json:"lastUpdated"`
+	Sgvs        []json.RawMessage `json:"sgvs"`
+	Mbgs        []json.RawMessage `json:"mbgs"`
+	Treatments  []json.RawMessage `json:"treatments"`
+}
+
+func (u *DataUpdate) HasGlucose() bool {
+	return len(u.Sgvs) > 0 || len(u.Mbgs) > 0
+}
+
+func (u *DataUpdate) HasTreatments() bool {
+	return len(u.Treatments) > 0
+}
+
+type ListenerAuth struct {
+	// APISecret is sha1 hash (hex) of api-secret
+	APISecret string
+	// APIToken is access token
+	APIToken string
+}
+
+// Listener subscribes to Nightscout real-time dataUpdate events (socket.io)
+type Listener struct {
+	url    *url.URL
+	auth   ListenerAuth
+	client *http.Client
+}
+
+type authorizeMessage struct {
+	Client  string `json:"client"`
+	Secret  string `json:"secret,omitempty"`
+	Token   string `json:"token,omitempty"`
+	History int    `json:"history"`
+}
+
+type authorizeResponse struct {
+	Read bool `json:"read"`
+}
+
+func NewListener(baseUrl string, auth ListenerAuth, client *http.Client) (*Listener, error) {
+	u, err := url.Parse(baseUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &Listener{
+		url:    u,
+		auth:   auth,
+		client: client,
+	}, nil
+}
+
+// Listen calls fn for each dataUpdate event until ctx is done.
+// The connection is re-established with growing delay after errors
+func (l *Listener) Listen(ctx context.Context, fn func(*DataUpdate)) error {
+
+	delay := listenerMinReconnectDelay
+
+	for {
+		connected, err := l.listen(ctx, fn)
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		if connected {
+			delay = listenerMinReconnectDelay
+		}
+
+		log.Warn().
+			Err(err).
+			Dur("reconnectIn", delay).
+			Msg("Nightscout listener disconnected")
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(delay):
+		}
+
+		delay *= 2
+		if delay > listenerMaxReconnectDelay {
+			delay = listenerMaxReconnectDelay
+		}
+	}
+}
+
+func (l *Listener) listen(ctx context.Context, fn func(*DataUpdate)) (connected bool, err error) {
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	c, err := socketio.Dial(ctx, l.url, l.client)
+	if err != nil {
+		return false, err
+	}
+
+	c.On("dataUpdate", func(args []json.RawMessage) {
+		if len(args) == 0 {
+			return
+		}
+
+		update := new(DataUpdate)
+		if err := json.Unmarshal(args[0], update); err != nil {
+			log.Warn().
+				Err(err).
+				Msg("Bad dataUpdate event")
+			return
+		}
+
+		fn(update)
+	})
+
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- c.Run(ctx)
+	}()
+
+	authCtx, authCancel := context.WithTimeout(ctx, listenerAuthTimeout)
+	args, err := c.EmitWithAck(authCtx, "authorize", &authorizeMessage{
+		Client:  "web",
+		Secret:  l.auth.APISecret,
+		Token:   l.auth.APIToken,
+		History: 1,
+	})
+	authCancel()
+	if err != nil {
+		return false, NewNightscoutError(err, "listener: authorize failed")
+	}
+
+	auth := new(authorizeResponse)
+	if len(args) > 0 {
+		if err := json.Unmarshal(args[0], auth); err != nil {
+			return false, NewNightscoutError(err, "listener: bad authorize response")
+		}
+	}
+
+	if !auth.Read {
+		return false, NewNightscoutError(errors.New("no read permission"), "listener: authorize failed")
+	}
+
+	log.Info().
+		Str("url", l.url.Redacted()).
+		Msg("Nightscout listener connected")
+
+	select {
+	case err = <-runErr:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	closeCtx, closeCancel := context.WithTimeout(context.Background(), time.Second)
+	defer closeCancel()
+	c.Close(closeCtx)
+
+	return true, err
+}
@@ -0,0 +1,153 @@
+package nightscout
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	// aggregation of readings in a grid bucket
+	AggregateMean    = "mean"
+	AggregateMedian  = "median"
+	AggregateNearest = "nearest"
+
+	// Libre sensor history interval
+	DefaultHistoryInterval = 15 * time.Minute
+)
+
+var Aggregates = []string{AggregateMean, AggregateMedian, AggregateNearest}
+
+type ResampleOptions struct {
+	// Interval of the grid. DefaultHistoryInterval if not set
+	Interval time.Duration
+	// Anchors are grid origins (e.g. sensor starts). A reading uses the latest anchor before it
+	// (the earliest anchor for readings before all anchors). The grid is aligned to Unix epoch without anchors
+	Anchors []time.Time
+	// Aggregate is mean, median or nearest
+	Aggregate string
+	// Until drops buckets ending after it, they may be incomplete (e.g. export window end). Not used if zero
+	Until time.Time
+}
+
+func (o ResampleOptions) interval() time.Duration {
+	if o.Interval <= 0 {
+		return DefaultHistoryInterval
+	}
+	return o.Interval
+}
+
+func (o ResampleOptions) anchor(ts time.Time) time.Time {
+	if len(o.Anchors) == 0 {
+		return time.Unix(0, 0)
+	}
+	anchor := o.Anchors[0]
+	for _, a := range o.Anchors[1:] {
+		if a.After(ts) {
+			break
+		}
+		anchor = a
+	}
+	return anchor
+}
+
+// slot returns grid point of the reading. The bucket of grid point t is [t, t+interval),
+// so the grid point is never later than its readings
+func (o ResampleOptions) slot(ts time.Time) time.Time {
+	anchor := o.anchor(ts)
+	interval := o.interval()
+	d := ts.Sub(anchor)
+	k := d / interval
+	if d%interval < 0 {
+		k--
+	}
+	return anchor.Add(k * interval)
+}
+
+// Resample aligns readings to the grid. Every non-empty bucket gives one reading at the grid point
+// with aggregated sgv. Interpolated readings are used only for buckets without real readings.
+// Returns entries newest first
+func (es GlucoseEntries) Resample(opts ResampleOptions) (*GlucoseEntries, error) {
+
+	switch opts.Aggregate {
+	case AggregateMean, AggregateMedian, AggregateNearest:
+	default:
+		return nil, fmt.Errorf("unknown aggregate %q, expected one of %v", opts.Aggregate, Aggregates)
+	}
+
+	opts.Anchors = append([]time.Time(nil), opts.Anchors...)
+	sort.Slice(opts.Anchors, func(i, j int) bool {
+		return opts.Anchors[i].Before(opts.Anchors[j])
+	})
+
+	// ascending
+	sorted := es.sorted()
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Date.Time().Before(sorted[j].Date.Time())
+	})
+
+	var buckets []GlucoseEntries
+	var slots []time.Time
+	for _, e := range sorted {
+		slot := opts.slot(e.Date.Time())
+		if len(slots) == 0 || !slots[len(slots)-1].Equal(slot) {
+			slots = append(slots, slot)
+			buckets = append(buckets, nil)
+		}
+		buckets[len(buckets)-1] = append(buckets[len(buckets)-1], e)
+	}
+
+	result := make(GlucoseEntries, 0, len(buckets))
+	for i := len(buckets) - 1; i >= 0; i-- {
+		if !opts.Until.IsZero() && slots[i].Add(opts.interval()).After(opts.Until) {
+			continue
+		}
+		result = append(result, aggregate(slots[i], buckets[i], opts.Aggregate))
+	}
+
+	return &result, nil
+}
+
+// aggregate returns the reading of the bucket at grid point ts. bucket is in ascending order
+func aggregate(ts time.Time, bucket GlucoseEntries, how string) *GlucoseEntry {
+
+	readings := bucket.Filter(NotInterpolated())
+	if readings.Len() == 0 {
+		readings = &bucket
+	}
+
+	// the first reading is the nearest to the grid point
+	nearest := (*readings)[0]
+
+	var sgv float64
+	switch how {
+	case AggregateNearest:
+		sgv = nearest.Sgv.Float64()
+	case AggregateMean:
+		for _, e := range *readings {
+			sgv += e.Sgv.Float64()
+		}
+		sgv /= float64(readings.Len())
+	case AggregateMedian:
+		values := make([]float64, 0, readings.Len())
+		for _, e := range *readings {
+			values = append(values, e.Sgv.Float64())
+		}
+		sort.Float64s(values)
+		n := len(values)
+		sgv = values[n/2]
+		if n%2 == 0 {
+			sgv = (values[n/2-1] + values[n/2]) / 2
+		}
+	}
+
+	entry := *nearest
+	date := NSTime(ts)
+	entry.Date = &date
+	entry.DateString = ts.UTC()
+	entry.SysTime = ts.UTC()
+	entry.Sgv = SVG(math.Round(sgv))
+
+	return &entry
+}
@@ -0,0 +1,122 @@
+package nightscout
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestResample(t *testing.T) {
+
+	type point struct {
+		minute int
+		sgv    float64
+	}
+
+	tests := []struct {
+		name         string
+		readings     map[int]float64
+		interpolated map[int]float64
+		opts         ResampleOptions
+		want         []point
+	}{
+		{
+			// gapsBase is aligned to the epoch grid
+			name:     "mean",
+			readings: map[int]float64{0: 100, 5: 110, 10: 120, 15: 130, 20: 141},
+			opts:     ResampleOptions{Aggregate: AggregateMean},
+			want:     []point{{15, 136}, {0, 110}},
+		},
+		{
+			name:     "median",
+			readings: map[int]float64{0: 100, 5: 180, 10: 120, 15: 130, 20: 140},
+			opts:     ResampleOptions{Aggregate: AggregateMedian},
+			want:     []point{{15, 135}, {0, 120}},
+		},
+		{
+			name:     "nearest",
+			readings: map[int]float64{2: 100, 5: 180, 10: 120},
+			opts:     ResampleOptions{Aggregate: AggregateNearest},
+			want:     []point{{0, 100}},
+		},
+		{
+			name:     "default interval",
+			readings: map[int]float64{0: 100, 14: 100, 15: 100, 29: 100, 30: 100},
+			opts:     ResampleOptions{Aggregate: AggregateNearest},
+			want:     []point{{30, 100}, {15, 100}, {0, 100}},
+		},
+		{
+			name:     "interval",
+			readings: map[int]float64{0: 100, 5: 100, 10: 100},
+			opts:     ResampleOptions{Interval: 5 * time.Minute, Aggregate: AggregateNearest},
+			want:     []point{{10, 100}, {5, 100}, {0, 100}},
+		},
+		{
+			name:     "anchor",
+			readings: map[int]float64{7: 100, 12: 110, 22: 120, 27: 130},
+			opts:     ResampleOptions{Aggregate: AggregateMean, Anchors: []time.Time{gapsBase.Add(7 * time.Minute)}},
+			want:     []point{{22, 125}, {7, 105}},
+		},
+		{
+			// a reading before all anchors uses the earliest anchor, other readings the latest anchor before them
+			name:     "several anchors",
+			readings: map[int]float64{0: 100, 10: 110, 25: 120, 40: 130},
+			opts: ResampleOptions{Aggregate: AggregateNearest, Anchors: []time.Time{
+				gapsBase.Add(35 * time.Minute),
+				gapsBase.Add(5 * time.Minute),
+			}},
+			want: []point{{35, 130}, {20, 120}, {5, 110}, {-10, 100}},
+		},
+		{
+			// the last bucket ends after Until
+			name:     "until",
+			readings: map[int]float64{0: 100, 15: 110, 20: 120},
+			opts:     ResampleOptions{Aggregate: AggregateNearest, Until: gapsBase.Add(25 * time.Minute)},
+			want:     []point{{0, 100}},
+		},
+		{
+			name:     "until bucket end",
+			readings: map[int]float64{0: 100, 15: 110, 20: 120},
+			opts:     ResampleOptions{Aggregate: AggregateNearest, Until: gapsBase.Add(30 * time.Minute)},
+			want:     []point{{15, 110}, {0, 100}},
+		},
+		{
+			// interpolated readings are used only for buckets without real readings
+			name:         "interpolated",
+			readings:     map[int]float64{0: 100, 30: 160},
+			interpolated: map[int]float64{5: 110, 10: 120, 15: 130, 20: 140, 25: 150},
+			opts:         ResampleOptions{Aggregate: AggregateMean},
+			want:         []point{{30, 160}, {15, 140}, {0, 100}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries := readingsAt(tt.readings)
+			for _, e := range readingsAt(tt.interpolated) {
+				e.Interpolated = true
+				entries = append(entries, e)
+			}
+
+			result, err := entries.Resample(tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []point
+			for _, e := range *result {
+				got = append(got, point{at(e.Date.Time()), e.Sgv.Float64()})
+			}
+
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResampleBadAggregate(t *testing.T) {
+	if _, err := readingsAt(map[int]float64{0: 100}).Resample(ResampleOptions{Aggregate: "max"}); err == nil {
+		t.Fatal("error expected")
+	}
+}
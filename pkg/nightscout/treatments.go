@@ -4,7 +4,6 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -18,6 +17,7 @@ type TreatmentsGetter interface {
 
 type TreatmentInterface interface {
 	List(ctx context.Context, opts ListOptions) (*Treatments, error)
+	Iterate(ctx context.Context, opts ListOptions, fn TreatmentsVisitorFunc) error
 	Create(ctx context.Context, treatment *Treatment) (result Treatments, err error)
 	Delete(ctx context.Context, id string) error
 }
@@ -28,24 +28,87 @@ type treatments struct {
 
 func (t *treatments) List(ctx context.Context, opts ListOptions) (result *Treatments, err error) {
 	result = &Treatments{}
-	r := t.client.Get().
-		Name("treatments").
-		Param("find[created_at][$gte]", opts.DateFrom.UTC().Format(time.RFC3339)).
-		Param("find[created_at][$lte]", opts.DateTo.UTC().Format(time.RFC3339)).
-		Param("count", strconv.Itoa(opts.Count))
+	err = t.Iterate(ctx, opts, func(e *Treatment, _ error) error {
+		result.Append(e)
+		return nil
+	})
+	return
+}
 
-	if len(opts.Kind) > 0 {
-		r = r.Param(fmt.Sprintf("find[%s][$gt]", opts.Kind), "0")
-	}
+// Iterate pages through treatments (newest first) and calls fn for each treatment.
+// After each page the find[created_at][$lte] bound is moved to the oldest received treatment
+func (t *treatments) Iterate(ctx context.Context, opts ListOptions, fn TreatmentsVisitorFunc) error {
+
+	var (
+		received int
+		dateTo   = opts.DateTo
+		// treatments of the page boundary, they will be received again
+		seen = make(map[string]struct{})
+	)
+
+	for {
+		count := opts.pageCount(received)
+		if count == 0 {
+			return nil
+		}
 
-	err = r.Do(ctx).Into(result)
+		r := t.client.Get().
+			Name("treatments").
+			Param("find[created_at][$gte]", opts.DateFrom.UTC().Format(time.RFC3339)).
+			Param("find[created_at][$lte]", dateTo.UTC().Format(time.RFC3339)).
+			Param("count", strconv.Itoa(count))
 
-	if err != nil {
-		return result, NewNightscoutError(err, "cant retreive list treatments")
-	}
+		if len(opts.Kind) > 0 {
+			r = r.Param(fmt.Sprintf("find[%s][$gt]", opts.Kind), "0")
+		}
 
-	return
+		page := &Treatments{}
+		if err := r.Do(ctx).Into(page); err != nil {
+			return NewNightscoutError(err, "cant retreive list treatments")
+		}
+
+		fresh := 0
+		oldest := dateTo
+		for _, e := range *page {
+			if e.CreatedAt.Before(oldest) {
+				oldest = e.CreatedAt
+			}
+
+			if _, ok := seen[e.ID]; ok {
+				continue
+			}
+
+			fresh++
+			received++
+			if err := fn(e, nil); err != nil {
+				return err
+			}
+		}
+
+		if page.Len() < count {
+			return nil
+		}
+
+		// created_at bound has seconds precision
+		oldest = oldest.Truncate(time.Second)
+
+		seen = make(map[string]struct{})
+
+		// the whole page is boundary treatments, move the bound past the second
+		if fresh == 0 {
+			dateTo = oldest.Add(-time.Second)
+			continue
+		}
+
+		page.Visit(func(e *Treatment, _ error) error {
+			if !e.CreatedAt.Before(oldest) {
+				seen[e.ID] = struct{}{}
+			}
+			return nil
+		})
 
+		dateTo = oldest
+	}
 }
 
 func (t *treatments) Create(ctx context.Context, treatment *Treatment) (result Treatments, err error) {
@@ -86,20 +149,100 @@ func newTreatments(c Client) *treatments {
 	}
 }
 
-type InsulinInjections string
+// Grams is protein or fat amount. Nightscout careportal saves it as string
+type Grams float64
 
-var reLongActingInsulin = regexp.MustCompile(`^.*(Lantus|Toujeo).*$`)
+func (g *Grams) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		var v float64
+		if err := json.Unmarshal(data, &v); err != nil {
+			return fmt.Errorf("bad grams value %s: %w", data, err)
+		}
+		*g = Grams(v)
+		return nil
+	}
 
-func (ii InsulinInjections) IsLongActing() bool {
-	return reLongActingInsulin.MatchString(ii.String())
+	// empty or free text is zero
+	v, err := strconv.ParseFloat(strings.TrimSpace(strings.ReplaceAll(s, ",", ".")), 64)
+	if err != nil {
+		*g = 0
+		return nil
+	}
+	*g = Grams(v)
+	return nil
+}
+
+func (g Grams) Float64() float64 {
+	return float64(g)
+}
+
+// InsulinInjection is a pen injection of the treatment
+type InsulinInjection struct {
+	Insulin string  `json:"insulin"`
+	Units   float64 `json:"units"`
+}
+
+// InsulinInjections is encoded by Nightscout clients (e.g. xDrip+) as JSON string: "[{\"insulin\":\"Lantus\",\"units\":10}]".
+// Free text (e.g. "Lantus 10u") is decoded as one injection without units
+type InsulinInjections []InsulinInjection
+
+func (ii *InsulinInjections) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		// not a string, try plain array
+		var injections []InsulinInjection
+		if err := json.Unmarshal(data, &injections); err != nil {
+			return fmt.Errorf("bad insulinInjections %s: %w", data, err)
+		}
+		*ii = injections
+		return nil
+	}
+
+	if len(strings.TrimSpace(s)) == 0 {
+		*ii = nil
+		return nil
+	}
+
+	// free text names the insulin, the units of the treatment insulin are used then
+	var injections []InsulinInjection
+	if err := json.Unmarshal([]byte(s), &injections); err != nil {
+		*ii = InsulinInjections{{Insulin: strings.TrimSpace(s)}}
+		return nil
+	}
+	*ii = injections
+	return nil
+}
+
+func (ii InsulinInjections) MarshalJSON() ([]byte, error) {
+	return json.Marshal(ii.String())
+}
+
+// IsLongActing reports whether any injection is of long acting insulin of the catalog
+func (ii InsulinInjections) IsLongActing(catalog *InsulinCatalog) bool {
+	for _, injection := range ii {
+		if insulin, ok := catalog.Find(injection.Insulin); ok && insulin.IsLongActing() {
+			return true
+		}
+	}
+	return false
 }
 
 func (ii InsulinInjections) String() string {
-	return string(ii)
+	if len(ii) == 0 {
+		return ""
+	}
+	data, err := json.Marshal([]InsulinInjection(ii))
+	if err != nil {
+		return ""
+	}
+	return string(data)
 }
 
-func NewInsulinInjections(units float64, insType InsulinType) InsulinInjections {
-	return InsulinInjections(fmt.Sprintf("[{\"insulin\":\"%s\",\"units\":%.1f}]", insType.String(), units))
+func NewInsulinInjections(units float64, insulin *InsulinType) InsulinInjections {
+	return InsulinInjections{
+		{Insulin: insulin.String(), Units: units},
+	}
 }
 
 type Treatment struct {
@@ -109,25 +252,67 @@ type Treatment struct {
 	CreatedAt         time.Time         `json:"created_at"`
 	Insulin           float64           `json:"insulin"`
 	Carbs             float64           `json:"carbs"`
-	InsulinInjections InsulinInjections `json:"insulinInjections"`
+	Protein           Grams             `json:"protein,omitempty"`
+	Fat               Grams             `json:"fat,omitempty"`
+	FoodType          string            `json:"foodType,omitempty"`
+	InsulinInjections InsulinInjections `json:"insulinInjections,omitempty"`
+	Glucose           float64           `json:"glucose,omitempty"`
+	GlucoseType       string            `json:"glucoseType,omitempty"`
+	Units             string            `json:"units,omitempty"`
+	Notes             string            `json:"notes,omitempty"`
+	// Duration in minutes
+	Duration float64 `json:"duration,omitempty"`
+	// API v3 fields
+	Identifier  string `json:"identifier,omitempty"`
+	SrvModified int64  `json:"srvModified,omitempty"`
+	IsValid     *bool  `json:"isValid,omitempty"`
+}
+
+// Identity returns API v3 identifier or _id for documents created with API v1
+func (t *Treatment) Identity() string {
+	if len(t.Identifier) > 0 {
+		return t.Identifier
+	}
+	return t.ID
+}
+
+// Deleted reports whether treatment is deleted (API v3 history)
+func (t *Treatment) Deleted() bool {
+	return t.IsValid != nil && !*t.IsValid
 }
 
 func (t *Treatment) MarshalJSON() ([]byte, error) {
-	// exclude ID
+	// exclude ID and server side fields
 	return json.Marshal(&struct {
 		EventType         string            `json:"eventType"`
 		EnteredBy         string            `json:"enteredBy"`
 		CreatedAt         time.Time         `json:"created_at"`
 		Insulin           float64           `json:"insulin"`
 		Carbs             float64           `json:"carbs"`
-		InsulinInjections InsulinInjections `json:"insulinInjections"`
+		Protein           Grams             `json:"protein,omitempty"`
+		Fat               Grams             `json:"fat,omitempty"`
+		FoodType          string            `json:"foodType,omitempty"`
+		InsulinInjections InsulinInjections `json:"insulinInjections,omitempty"`
+		Glucose           float64           `json:"glucose,omitempty"`
+		GlucoseType       string            `json:"glucoseType,omitempty"`
+		Units             string            `json:"units,omitempty"`
+		Notes             string            `json:"notes,omitempty"`
+		Duration          float64           `json:"duration,omitempty"`
 	}{
 		EventType:         t.EventType,
 		EnteredBy:         t.EnteredBy,
 		CreatedAt:         t.CreatedAt,
 		Insulin:           t.Insulin,
 		Carbs:             t.Carbs,
+		Protein:           t.Protein,
+		Fat:               t.Fat,
+		FoodType:          t.FoodType,
 		InsulinInjections: t.InsulinInjections,
+		Glucose:           t.Glucose,
+		GlucoseType:       t.GlucoseType,
+		Units:             t.Units,
+		Notes:             t.Notes,
+		Duration:          t.Duration,
 	})
 }
 
@@ -135,66 +320,33 @@ func (t *Treatment) Kind() string {
 	return "Treatment"
 }
 
-type InsulinType int8
-
-const (
-	Fiasp InsulinType = iota
-	Novorapid
-	Humalog
-	Lispro
-	Actapid
-	Lantus
-	Toujeo
-	InsulinTypeUnknown
-)
-
-var insulinTypeLoCaseMap = map[string]InsulinType{
-	"fiasp":     Fiasp,
-	"novorapid": Novorapid,
-	"humalog":   Humalog,
-	"lispro":    Lispro,
-	"actapid":   Actapid,
-	"lantus":    Lantus,
-	"toujeo":    Toujeo,
-}
-
-func ParseInsulinType(value string) (InsulinType, error) {
-	t, ok := insulinTypeLoCaseMap[strings.ToLower(value)]
-	if !ok {
-		return InsulinTypeUnknown, fmt.Errorf("parse error: unknown insulin type %s", value)
+// GlucoseMgPerDl returns glucose value in mg/dL according to units
+func (t *Treatment) GlucoseMgPerDl() SVG {
+	if strings.EqualFold(t.Units, UnitsMmol) {
+		return SVG(t.Glucose * 18)
 	}
-	return t, nil
+	return SVG(t.Glucose)
 }
 
-func (it InsulinType) String() string {
-	switch it {
-	case Lantus:
-		return "Lantus"
-	case Toujeo:
-		return "Toujeo"
-	case Fiasp:
-		return "FIASP"
-	case Novorapid:
-		return "Novorapid"
-	case Humalog:
-		return "Humalog"
-	case Lispro:
-		return "Lispro"
-	case Actapid:
-		return "Actapid"
-	default:
-		return "unknown"
-	}
+// IsFingerstick reports whether the treatment is a finger blood glucose check
+func (t *Treatment) IsFingerstick() bool {
+	return t.Glucose > 0 && !strings.EqualFold(t.GlucoseType, GlucoseTypeSensor)
 }
 
-func (it InsulinType) IsLongActing() bool {
-	switch it {
-	case Lantus, Toujeo:
-		return true
-	default:
-		return false
-	}
-}
+const (
+	EventTypeExercise       = "Exercise"
+	EventTypeNote           = "Note"
+	EventTypeAnnouncement   = "Announcement"
+	EventTypeSensorStart    = "Sensor Start"
+	EventTypeSensorChange   = "Sensor Change"
+	EventTypeMealBolus      = "Meal Bolus"
+	EventTypeSnackBolus     = "Snack Bolus"
+	EventTypeCarbCorrection = "Carb Correction"
+
+	UnitsMmol         = "mmol"
+	GlucoseTypeFinger = "Finger"
+	GlucoseTypeSensor = "Sensor"
+)
 
 func NewTreatment() *Treatment {
 	return new(Treatment)
@@ -230,6 +382,13 @@ func TreatmentOnlyAfter(date time.Time) TreatmentFilterFunc {
 	}
 }
 
+// NotEnteredBy skips treatments created by enteredBy (e.g. imported from LibreView)
+func NotEnteredBy(enteredBy string) TreatmentFilterFunc {
+	return func(e *Treatment) bool {
+		return e.EnteredBy != enteredBy
+	}
+}
+
 func (es *Treatments) Filter(fn TreatmentFilterFunc) (result *Treatments) {
 	result = &Treatments{}
 	es.Visit(func(e *Treatment, _ error) error {
@@ -0,0 +1,169 @@
+package nightscout
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// treatmentsServer serves treatments like Nightscout API v1: find[created_at] bounds compared as strings, newest first
+func treatmentsServer(t *testing.T, treatments Treatments) *httptest.Server {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		from := q.Get("find[created_at][$gte]")
+		to := q.Get("find[created_at][$lte]")
+		count, _ := strconv.Atoi(q.Get("count"))
+
+		var page []json.RawMessage
+		sorted := append(Treatments(nil), treatments...)
+		sort.SliceStable(sorted, func(i, j int) bool {
+			return sorted[i].CreatedAt.After(sorted[j].CreatedAt)
+		})
+		for _, tr := range sorted {
+			createdAt := tr.CreatedAt.UTC().Format("2006-01-02T15:04:05.000Z")
+			if createdAt < from || createdAt > to {
+				continue
+			}
+			if len(page) == count {
+				break
+			}
+			// Treatment.MarshalJSON omits _id
+			data, _ := json.Marshal(map[string]interface{}{
+				"_id":        tr.ID,
+				"eventType":  tr.EventType,
+				"created_at": createdAt,
+				"insulin":    tr.Insulin,
+			})
+			page = append(page, data)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(page); err != nil {
+			t.Error(err)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func TestTreatmentsIterate(t *testing.T) {
+
+	base := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+
+	testTreatments := func(millis ...int) (result Treatments) {
+		for i, ms := range millis {
+			result = append(result, &Treatment{
+				ID:        fmt.Sprintf("t%02d", i),
+				EventType: "Correction Bolus",
+				CreatedAt: base.Add(time.Duration(ms) * time.Millisecond),
+				Insulin:   1,
+			})
+		}
+		return
+	}
+
+	tests := []struct {
+		name     string
+		millis   []int
+		pageSize int
+		want     int
+	}{
+		{name: "several pages", millis: []int{0, 60000, 120000, 180000, 240000}, pageSize: 2, want: 5},
+		{name: "page size 1", millis: []int{0, 60000, 120000}, pageSize: 1, want: 3},
+		// the bound is truncated to seconds, treatments of one second are received on the next page again
+		{name: "one second on page boundary", millis: []int{0, 60100, 60200, 120000}, pageSize: 2, want: 4},
+		{name: "second larger than page", millis: []int{0, 60100, 60200, 60300, 120000}, pageSize: 1, want: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := treatmentsServer(t, testTreatments(tt.millis...))
+
+			client, err := New(srv.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := client.Treatments().List(context.Background(), ListOptions{
+				DateFrom: base.Add(-time.Minute),
+				DateTo:   base.Add(time.Hour),
+				PageSize: tt.pageSize,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got.Len() != tt.want {
+				t.Fatalf("got %d treatments, want %d", got.Len(), tt.want)
+			}
+
+			ids := make(map[string]struct{})
+			for _, tr := range *got {
+				if _, ok := ids[tr.ID]; ok {
+					t.Errorf("treatment %s received twice", tr.ID)
+				}
+				ids[tr.ID] = struct{}{}
+			}
+
+			if _, ok := ids["t00"]; !ok {
+				t.Error("oldest treatment is lost")
+			}
+		})
+	}
+}
+
+func TestInsulinInjectionsUnmarshal(t *testing.T) {
+
+	tests := []struct {
+		name string
+		data string
+		want InsulinInjections
+	}{
+		{
+			name: "JSON string",
+			data: `"[{\"insulin\":\"Lantus\",\"units\":10},{\"insulin\":\"Fiasp\",\"units\":4.5}]"`,
+			want: InsulinInjections{{Insulin: "Lantus", Units: 10}, {Insulin: "Fiasp", Units: 4.5}},
+		},
+		{
+			name: "array",
+			data: `[{"insulin":"Tresiba","units":12}]`,
+			want: InsulinInjections{{Insulin: "Tresiba", Units: 12}},
+		},
+		{name: "free text", data: `" Lantus 10u "`, want: InsulinInjections{{Insulin: "Lantus 10u"}}},
+		{name: "empty string", data: `""`},
+		{name: "blank string", data: `"  "`},
+		{name: "null", data: `null`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var tr Treatment
+			if err := json.Unmarshal([]byte(`{"eventType":"Correction Bolus","insulinInjections":`+tt.data+`}`), &tr); err != nil {
+				t.Fatal(err)
+			}
+
+			if len(tr.InsulinInjections) != len(tt.want) {
+				t.Fatalf("got %v, want %v", tr.InsulinInjections, tt.want)
+			}
+			for i := range tt.want {
+				if tr.InsulinInjections[i] != tt.want[i] {
+					t.Errorf("injection %d: got %v, want %v", i, tr.InsulinInjections[i], tt.want[i])
+				}
+			}
+		})
+	}
+
+	var tr Treatment
+	if err := json.Unmarshal([]byte(`{"insulinInjections":42}`), &tr); err == nil {
+		t.Error("error expected for number")
+	}
+}
@@ -0,0 +1,537 @@
+package nightscout
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/blutz1982/go-nsexporter-libreview/pkg/rest"
+)
+
+const (
+	APIVersionV1 = "v1"
+	APIVersionV3 = "v3"
+
+	versionedAPIPathV3 = "api/v3"
+
+	// app field of documents created with API v3
+	v3App = "nsexport"
+)
+
+// HistoryOptions is options of API v3 history requests
+type HistoryOptions struct {
+	// Since is srvModified bound (exclusive). Zero value means all documents
+	Since time.Time
+	// Count is max count of documents in result. 0 means no limit
+	Count int
+	// PageSize is count of documents per API request. DefaultPageSize if not set
+	PageSize int
+}
+
+func (o HistoryOptions) pageCount(received int) int {
+	return ListOptions{Count: o.Count, PageSize: o.PageSize}.pageCount(received)
+}
+
+// GlucoseHistoryInterface is implemented by API v3 glucose client.
+// History calls fn for each entry modified after opts.Since (deleted entries included, see GlucoseEntry.Deleted)
+// and returns srvModified of the last received entry
+type GlucoseHistoryInterface interface {
+	History(ctx context.Context, opts HistoryOptions, fn VisitorFunc) (lastModified time.Time, err error)
+}
+
+// TreatmentsHistoryInterface is implemented by API v3 treatments client
+type TreatmentsHistoryInterface interface {
+	History(ctx context.Context, opts HistoryOptions, fn TreatmentsVisitorFunc) (lastModified time.Time, err error)
+}
+
+type nightscoutV3 struct {
+	restClient rest.Interface
+}
+
+// NewV3WithAPIToken returns API v3 client authorized with access token.
+// API v3 does not accept api-secret, so only token auth is supported
+func NewV3WithAPIToken(ctx context.Context, baseUrl, apiToken string, opts ...rest.RESTClientOpt) (Client, error) {
+
+	u, err := url.Parse(baseUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := newJWTClient(ctx, u, apiToken, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &nightscoutV3{
+		restClient: rest.NewRESTClient(u, versionedAPIPathV3, contentConfig, client, opts...),
+	}, nil
+}
+
+func NewV3WithJWTToken(baseUrl, JWTToken string, opts ...rest.RESTClientOpt) (Client, error) {
+
+	u, err := url.Parse(baseUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &http.Client{
+		Transport: rest.NewBearerAuthRoundTripper(JWTToken, http.DefaultTransport.(*http.Transport).Clone()),
+	}
+
+	return &nightscoutV3{
+		restClient: rest.NewRESTClient(u, versionedAPIPathV3, contentConfig, client, opts...),
+	}, nil
+}
+
+func (ns *nightscoutV3) RESTClient() rest.Interface {
+	if ns == nil {
+		return nil
+	}
+	return ns.restClient
+}
+
+func (ns *nightscoutV3) Treatments() TreatmentInterface {
+	return &treatmentsV3{client: ns.restClient}
+}
+
+func (ns *nightscoutV3) Glucose() GlucoseInterface {
+	return &glucoseV3{client: ns.restClient}
+}
+
+func (ns *nightscoutV3) DeviceStatus() DeviceInterface {
+	return &deviceV3{client: ns.restClient}
+}
+
+func (ns *nightscoutV3) Profiles() ProfileInterface {
+	return &profileV3{client: ns.restClient}
+}
+
+// v3Into decodes API v3 response. Nightscout 15+ wraps the payload into {"status": ..., "result": ...}
+func v3Into(res rest.Result, obj any) error {
+	if err := res.Error(); err != nil {
+		return err
+	}
+
+	body := bytes.TrimSpace(res.Body())
+	if len(body) == 0 {
+		return errors.New("empty response")
+	}
+
+	if body[0] == '{' {
+		envelope := struct {
+			Result json.RawMessage `json:"result"`
+		}{}
+		if err := json.Unmarshal(body, &envelope); err == nil && len(envelope.Result) > 0 {
+			body = envelope.Result
+		}
+	}
+
+	return json.Unmarshal(body, obj)
+}
+
+// v3CreateResponse is response of API v3 create operation
+type v3CreateResponse struct {
+	Identifier   string `json:"identifier"`
+	LastModified int64  `json:"lastModified"`
+}
+
+func v3Create(ctx context.Context, client rest.Interface, collection string, doc rest.Object) (*v3CreateResponse, error) {
+	res := client.Post().
+		Resource(collection).
+		Body(doc).
+		Do(ctx)
+
+	if err := res.Error(); err != nil {
+		return nil, err
+	}
+
+	created := new(v3CreateResponse)
+	// old servers respond with empty body and Location header
+	if len(bytes.TrimSpace(res.Body())) > 0 {
+		if err := v3Into(res, created); err != nil {
+			return nil, err
+		}
+	}
+
+	return created, nil
+}
+
+// v3Delete marks document as deleted (isValid=false), so history clients are notified about deletion
+func v3Delete(ctx context.Context, client rest.Interface, collection, identifier string) error {
+	return client.Delete().
+		Resource(collection).
+		Name(identifier).
+		Do(ctx).
+		Error()
+}
+
+// v3History pages through history of collection (oldest modification first).
+// Documents of the page boundary with the same srvModified are received again and skipped,
+// the page limit is extended by their count, so a full page always has new documents
+func v3History[T any](ctx context.Context, client rest.Interface, collection string, opts HistoryOptions, key func(T) (string, int64), fn func(T) error) (time.Time, error) {
+
+	var (
+		received     int
+		since        = opts.Since.UnixMilli()
+		lastModified = opts.Since
+		seen         = make(map[string]struct{})
+	)
+
+	if opts.Since.IsZero() {
+		since = 0
+	}
+
+	for {
+		count := opts.pageCount(received)
+		if count == 0 {
+			return lastModified, nil
+		}
+
+		limit := count + len(seen)
+
+		var page []T
+		err := v3Into(client.Get().
+			Resource(collection).
+			Name("history").
+			SubResource(strconv.FormatInt(since, 10)).
+			Param("limit", strconv.Itoa(limit)).
+			Do(ctx), &page)
+		if err != nil {
+			return lastModified, err
+		}
+
+		newest := since
+		for _, doc := range page {
+			id, modified := key(doc)
+			if modified > newest {
+				newest = modified
+			}
+
+			if _, ok := seen[id]; ok {
+				continue
+			}
+
+			received++
+			if err := fn(doc); err != nil {
+				return lastModified, err
+			}
+
+			if t := time.UnixMilli(modified); t.After(lastModified) {
+				lastModified = t
+			}
+		}
+
+		if len(page) < limit {
+			return lastModified, nil
+		}
+
+		seen = make(map[string]struct{})
+		for _, doc := range page {
+			if id, modified := key(doc); modified == newest {
+				seen[id] = struct{}{}
+			}
+		}
+
+		since = newest - 1
+	}
+}
+
+type glucoseV3 struct {
+	client rest.Interface
+}
+
+func (g glucoseV3) List(ctx context.Context, opts ListOptions) (result *GlucoseEntries, err error) {
+	result = &GlucoseEntries{}
+	err = g.Iterate(ctx, opts, func(e *GlucoseEntry, _ error) error {
+		result.Append(e)
+		return nil
+	})
+	return
+}
+
+// Iterate pages through entries (newest first) with limit and skip params
+func (g glucoseV3) Iterate(ctx context.Context, opts ListOptions, fn VisitorFunc) error {
+
+	var received int
+
+	for {
+		count := opts.pageCount(received)
+		if count == 0 {
+			return nil
+		}
+
+		req := g.client.Get().
+			Resource("entries").
+			Param("date$gte", strconv.FormatInt(opts.DateFrom.UTC().UnixMilli(), 10)).
+			Param("date$lte", strconv.FormatInt(opts.DateTo.UTC().UnixMilli(), 10)).
+			Param("sort$desc", "date").
+			Param("skip", strconv.Itoa(received)).
+			Param("limit", strconv.Itoa(count))
+
+		if len(opts.Kind) > 0 {
+			req = req.Param("type$eq", opts.Kind)
+		}
+
+		page := GlucoseEntries{}
+		if err := v3Into(req.Do(ctx), &page); err != nil {
+			return NewNightscoutError(err, "cant retreive list glucose entries")
+		}
+
+		for _, e := range page {
+			received++
+			if err := fn(e, nil); err != nil {
+				return err
+			}
+		}
+
+		if page.Len() < count {
+			return nil
+		}
+	}
+}
+
+func (g glucoseV3) History(ctx context.Context, opts HistoryOptions, fn VisitorFunc) (time.Time, error) {
+	lastModified, err := v3History(ctx, g.client, "entries", opts,
+		func(e *GlucoseEntry) (string, int64) { return e.Identity(), e.SrvModified },
+		func(e *GlucoseEntry) error { return fn(e, nil) },
+	)
+	if err != nil {
+		return lastModified, NewNightscoutError(err, "cant retreive glucose entries history")
+	}
+	return lastModified, nil
+}
+
+// Create posts entries one by one, API v3 has no batch create
+func (g glucoseV3) Create(ctx context.Context, entries GlucoseEntries) (result GlucoseEntries, err error) {
+
+	for _, e := range entries {
+		created, err := v3Create(ctx, g.client, "entries", &glucoseEntryCreateV3{
+			glucoseEntryCreate: newGlucoseEntryCreate(e),
+			App:                v3App,
+		})
+		if err != nil {
+			return result, NewNightscoutError(err, "cant create glucose entries")
+		}
+
+		entry := *e
+		entry.Identifier = created.Identifier
+		entry.SrvModified = created.LastModified
+		result.Append(&entry)
+	}
+
+	return
+}
+
+func (g glucoseV3) Delete(ctx context.Context, identifier string) error {
+	if err := v3Delete(ctx, g.client, "entries", identifier); err != nil {
+		return NewNightscoutError(err, "cant delete glucose entry")
+	}
+	return nil
+}
+
+// DeleteMatching deletes matched entries one by one, API v3 has no delete by query
+func (g glucoseV3) DeleteMatching(ctx context.Context, opts ListOptions) error {
+
+	if opts.DateFrom.IsZero() || opts.DateTo.IsZero() {
+		return NewNightscoutError(errors.New("date range is required"), "cant delete glucose entries")
+	}
+
+	entries, err := g.List(ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	return entries.Visit(func(e *GlucoseEntry, _ error) error {
+		return g.Delete(ctx, e.Identity())
+	})
+}
+
+type glucoseEntryCreateV3 struct {
+	*glucoseEntryCreate
+	App string `json:"app"`
+}
+
+func (c *glucoseEntryCreateV3) Kind() string {
+	return "GlucoseEntry"
+}
+
+type treatmentsV3 struct {
+	client rest.Interface
+}
+
+func (t *treatmentsV3) List(ctx context.Context, opts ListOptions) (result *Treatments, err error) {
+	result = &Treatments{}
+	err = t.Iterate(ctx, opts, func(e *Treatment, _ error) error {
+		result.Append(e)
+		return nil
+	})
+	return
+}
+
+// Iterate pages through treatments (newest first) with limit and skip params
+func (t *treatmentsV3) Iterate(ctx context.Context, opts ListOptions, fn TreatmentsVisitorFunc) error {
+
+	var received int
+
+	for {
+		count := opts.pageCount(received)
+		if count == 0 {
+			return nil
+		}
+
+		req := t.client.Get().
+			Resource("treatments").
+			Param("created_at$gte", opts.DateFrom.UTC().Format(time.RFC3339)).
+			Param("created_at$lte", opts.DateTo.UTC().Format(time.RFC3339)).
+			Param("sort$desc", "created_at").
+			Param("skip", strconv.Itoa(received)).
+			Param("limit", strconv.Itoa(count))
+
+		// the same semantics as find[<kind>][$gt]=0 of API v1
+		if len(opts.Kind) > 0 {
+			req = req.Param(opts.Kind+"$gt", "0")
+		}
+
+		page := Treatments{}
+		if err := v3Into(req.Do(ctx), &page); err != nil {
+			return NewNightscoutError(err, "cant retreive list treatments")
+		}
+
+		for _, e := range page {
+			received++
+			if err := fn(e, nil); err != nil {
+				return err
+			}
+		}
+
+		if page.Len() < count {
+			return nil
+		}
+	}
+}
+
+func (t *treatmentsV3) History(ctx context.Context, opts HistoryOptions, fn TreatmentsVisitorFunc) (time.Time, error) {
+	lastModified, err := v3History(ctx, t.client, "treatments", opts,
+		func(e *Treatment) (string, int64) { return e.Identity(), e.SrvModified },
+		func(e *Treatment) error { return fn(e, nil) },
+	)
+	if err != nil {
+		return lastModified, NewNightscoutError(err, "cant retreive treatments history")
+	}
+	return lastModified, nil
+}
+
+func (t *treatmentsV3) Create(ctx context.Context, treatment *Treatment) (result Treatments, err error) {
+
+	created, err := v3Create(ctx, t.client, "treatments", &treatmentCreateV3{Treatment: treatment})
+	if err != nil {
+		return result, NewNightscoutError(err, "cant create treatment")
+	}
+
+	tr := *treatment
+	tr.Identifier = created.Identifier
+	tr.SrvModified = created.LastModified
+	result.Append(&tr)
+
+	return
+}
+
+func (t *treatmentsV3) Delete(ctx context.Context, identifier string) error {
+	if err := v3Delete(ctx, t.client, "treatments", identifier); err != nil {
+		return NewNightscoutError(err, "cant delete treatment")
+	}
+	return nil
+}
+
+// treatmentCreateV3 adds date and app fields required by API v3
+type treatmentCreateV3 struct {
+	*Treatment
+}
+
+func (t *treatmentCreateV3) MarshalJSON() ([]byte, error) {
+	data, err := t.Treatment.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+
+	doc := make(map[string]any)
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	_, offset := t.CreatedAt.Local().Zone()
+	doc["date"] = t.CreatedAt.UnixMilli()
+	doc["utcOffset"] = offset / 60
+	doc["app"] = v3App
+
+	return json.Marshal(doc)
+}
+
+type deviceV3 struct {
+	client rest.Interface
+}
+
+func (d deviceV3) List(ctx context.Context, opts ListOptions) (result *DeviceStatuses, err error) {
+	result = &DeviceStatuses{}
+
+	var received int
+
+	for {
+		count := opts.pageCount(received)
+		if count == 0 {
+			break
+		}
+
+		page := DeviceStatuses{}
+		err = v3Into(d.client.Get().
+			Resource("devicestatus").
+			Param("created_at$gte", opts.DateFrom.UTC().Format(time.RFC3339)).
+			Param("created_at$lte", opts.DateTo.UTC().Format(time.RFC3339)).
+			Param("sort$desc", "created_at").
+			Param("skip", strconv.Itoa(received)).
+			Param("limit", strconv.Itoa(count)).
+			Do(ctx), &page)
+		if err != nil {
+			return result, NewNightscoutError(err, "cant retreive list device statuses")
+		}
+
+		received += len(page)
+		*result = append(*result, page...)
+
+		if len(page) < count {
+			break
+		}
+	}
+
+	if len(opts.Kind) > 0 {
+		result = result.Filter(OnlyDeviceType(opts.Kind))
+	}
+
+	return
+}
+
+type profileV3 struct {
+	client rest.Interface
+}
+
+func (p profileV3) Get(ctx context.Context) (*Profile, error) {
+	profiles := Profiles{}
+	err := v3Into(p.client.Get().
+		Resource("profile").
+		Param("sort$desc", "created_at").
+		Param("limit", "1").
+		Do(ctx), &profiles)
+	if err != nil {
+		return nil, NewNightscoutError(err, "cant get profile")
+	}
+
+	if len(profiles) < 1 {
+		return nil, NewNightscoutError(errors.New("empty profiles"), "no data")
+	}
+	return profiles[0], nil
+}
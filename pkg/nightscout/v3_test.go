@@ -0,0 +1,188 @@
+package nightscout
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// historyServer serves entries history like Nightscout API v3: srvModified after the bound of the path,
+// oldest modification first, limit. The bounds of the requests are recorded
+func historyServer(t *testing.T, entries GlucoseEntries) (*httptest.Server, *[]int64) {
+	t.Helper()
+
+	bounds := new([]int64)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		since, err := strconv.ParseInt(r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:], 10, 64)
+		if err != nil || !strings.HasPrefix(r.URL.Path, "/api/v3/entries/history/") {
+			t.Errorf("bad path %s", r.URL.Path)
+		}
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		*bounds = append(*bounds, since)
+
+		var page GlucoseEntries
+		for _, e := range entries {
+			if e.SrvModified > since {
+				page = append(page, e)
+			}
+		}
+		sort.SliceStable(page, func(i, j int) bool {
+			return page[i].SrvModified < page[j].SrvModified
+		})
+		if len(page) > limit {
+			page = page[:limit]
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(map[string]any{"status": 200, "result": page}); err != nil {
+			t.Error(err)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, bounds
+}
+
+// modified returns entries with identifiers e0, e1, ... modified at srvModified
+func modified(srvModified ...int64) (result GlucoseEntries) {
+	for i, m := range srvModified {
+		date := NSTime(time.UnixMilli(m))
+		result = append(result, &GlucoseEntry{
+			Identifier:  "e" + strconv.Itoa(i),
+			Date:        &date,
+			SrvModified: m,
+		})
+	}
+	return
+}
+
+func TestV3History(t *testing.T) {
+
+	tests := []struct {
+		name         string
+		entries      GlucoseEntries
+		opts         HistoryOptions
+		want         []string
+		wantBounds   []int64
+		wantModified int64
+	}{
+		{
+			name:         "one page",
+			entries:      modified(100, 200),
+			opts:         HistoryOptions{PageSize: 3},
+			want:         []string{"e0", "e1"},
+			wantBounds:   []int64{0},
+			wantModified: 200,
+		},
+		{
+			// the next page starts at srvModified-1 of the last entry, the boundary entries are skipped
+			name:         "page boundary",
+			entries:      modified(100, 200, 200, 300),
+			opts:         HistoryOptions{PageSize: 3},
+			want:         []string{"e0", "e1", "e2", "e3"},
+			wantBounds:   []int64{0, 199},
+			wantModified: 300,
+		},
+		{
+			// more than page size entries of one srvModified, the page of boundary entries only would have no new entries
+			name:         "boundary larger than page",
+			entries:      modified(100, 100, 100, 100, 200),
+			opts:         HistoryOptions{PageSize: 2},
+			want:         []string{"e0", "e1", "e2", "e3", "e4"},
+			wantBounds:   []int64{0, 99, 99},
+			wantModified: 200,
+		},
+		{
+			name:         "since",
+			entries:      modified(100, 200, 300),
+			opts:         HistoryOptions{Since: time.UnixMilli(200), PageSize: 3},
+			want:         []string{"e2"},
+			wantBounds:   []int64{200},
+			wantModified: 300,
+		},
+		{
+			// the cursor is not moved back
+			name:         "no changes",
+			entries:      modified(100),
+			opts:         HistoryOptions{Since: time.UnixMilli(200), PageSize: 3},
+			wantBounds:   []int64{200},
+			wantModified: 200,
+		},
+		{
+			name:         "count",
+			entries:      modified(100, 200, 300, 400),
+			opts:         HistoryOptions{Count: 3, PageSize: 2},
+			want:         []string{"e0", "e1", "e2"},
+			wantBounds:   []int64{0, 199},
+			wantModified: 300,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, bounds := historyServer(t, tt.entries)
+
+			ns, err := NewV3WithJWTToken(srv.URL, "token")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			lastModified, err := ns.Glucose().(GlucoseHistoryInterface).History(context.Background(), tt.opts, func(e *GlucoseEntry, _ error) error {
+				got = append(got, e.Identity())
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+			if !slices.Equal(*bounds, tt.wantBounds) {
+				t.Errorf("got bounds %v, want %v", *bounds, tt.wantBounds)
+			}
+			if lastModified.UnixMilli() != tt.wantModified {
+				t.Errorf("got last modified %d, want %d", lastModified.UnixMilli(), tt.wantModified)
+			}
+		})
+	}
+}
+
+func TestV3HistoryDeleted(t *testing.T) {
+
+	entries := modified(100, 200)
+	valid := false
+	entries[1].IsValid = &valid
+
+	srv, _ := historyServer(t, entries)
+
+	ns, err := NewV3WithJWTToken(srv.URL, "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var deleted []string
+	lastModified, err := ns.Glucose().(GlucoseHistoryInterface).History(context.Background(), HistoryOptions{}, func(e *GlucoseEntry, _ error) error {
+		if e.Deleted() {
+			deleted = append(deleted, e.Identity())
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// deleted entries are received and move the cursor
+	if !slices.Equal(deleted, []string{"e1"}) || lastModified.UnixMilli() != 200 {
+		t.Fatalf("got deleted %v, last modified %d", deleted, lastModified.UnixMilli())
+	}
+}
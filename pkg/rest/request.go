@@ -29,6 +29,10 @@ type Request struct {
 
 	resourceName string
 	resource     string
+	subresource  string
+
+	// idempotent request is retried regardless of its method
+	idempotent bool
 
 	// output
 	err error
@@ -107,6 +111,25 @@ func (r *Request) Name(resourceName string) *Request {
 	return r
 }
 
+func (r *Request) SubResource(subresources ...string) *Request {
+	if r.err != nil {
+		return r
+	}
+	subresource := path.Join(subresources...)
+	if len(r.subresource) != 0 {
+		r.err = fmt.Errorf("subresource already set to %q, cannot change to %q", r.subresource, subresource)
+		return r
+	}
+	for _, s := range subresources {
+		if msgs := IsValidPathSegmentName(s); len(msgs) != 0 {
+			r.err = fmt.Errorf("invalid subresource %q: %v", s, msgs)
+			return r
+		}
+	}
+	r.subresource = subresource
+	return r
+}
+
 func (r *Request) setParam(paramName, value string) *Request {
 	if r.params == nil {
 		r.params = make(url.Values)
@@ -122,6 +145,12 @@ func (r *Request) Param(paramName, s string) *Request {
 	return r.setParam(paramName, s)
 }
 
+// Idempotent allows retries of the request with any method (e.g. POST of login)
+func (r *Request) Idempotent() *Request {
+	r.idempotent = true
+	return r
+}
+
 func (r *Request) SetHeader(key string, values ...string) *Request {
 	if r.headers == nil {
 		r.headers = http.Header{}
@@ -143,24 +172,50 @@ type Result struct {
 }
 
 type ResultError struct {
-	err  error
-	body []byte
+	err        error
+	body       []byte
+	statusCode int
 }
 
 func (r Result) Error() error {
 	if r.err != nil {
 		return ResultError{
-			err:  r.err,
-			body: r.body,
+			err:        r.err,
+			body:       r.body,
+			statusCode: r.statusCode,
 		}
 	}
 	return nil
 }
 
+// StatusCode returns http status code of response or 0 if no response received
+func (r Result) StatusCode() int {
+	return r.statusCode
+}
+
+// Body returns raw response body
+func (r Result) Body() []byte {
+	return r.body
+}
+
 func (resErr ResultError) Error() string {
 	return fmt.Sprintf("%v: body : %s", resErr.err, resErr.body)
 }
 
+func (resErr ResultError) Unwrap() error {
+	return resErr.err
+}
+
+// StatusCode returns http status code of response or 0 if no response received
+func (resErr ResultError) StatusCode() int {
+	return resErr.statusCode
+}
+
+// Body returns raw response body
+func (resErr ResultError) Body() []byte {
+	return resErr.body
+}
+
 func (r Result) Into(obj any) error {
 	if r.err != nil {
 		return r.Error()
@@ -180,9 +235,6 @@ func (r Result) Into(obj any) error {
 
 func (r *Request) transformResponse(resp *http.Response, req *http.Request) Result {
 
-	// data, _ := httputil.DumpResponse(resp, true)
-	// fmt.Println(string(data))
-
 	var body []byte
 	if resp.Body != nil {
 		data, err := io.ReadAll(resp.Body)
@@ -253,22 +305,26 @@ func (r *Request) request(ctx context.Context, fn func(*http.Request, *http.Resp
 		client = http.DefaultClient
 	}
 
-	req, err := r.newHTTPRequest(ctx)
-	if err != nil {
-		return err
+	retry := r.c.retry
+	switch {
+	case r.body != nil:
+		// body reader can be read only once
+		retry = NoRetry()
+	case !r.idempotent && !retry.retryableMethod(r.verb):
+		retry = NoRetry()
 	}
 
-	// data, _ := httputil.DumpRequest(req, true)
-	// fmt.Println(string(data))
-
-	resp, err := client.Do(req)
+	// request is created for each attempt, bodyBytes is replayed
+	resp, err := retry.Do(ctx, client, func() (*http.Request, error) {
+		return r.newHTTPRequest(ctx)
+	})
 	if err != nil {
 		return err
 	}
 
 	defer resp.Body.Close()
 
-	fn(req, resp)
+	fn(resp.Request, resp)
 
 	return nil
 }
@@ -333,8 +389,8 @@ func (r *Request) Body(obj any) *Request {
 			return r
 		}
 
-		r.body = buff
-		r.bodyBytes = nil
+		r.body = nil
+		r.bodyBytes = buff.Bytes()
 		r.SetHeader("Content-Type", r.c.content.ContentType)
 	default:
 		r.err = fmt.Errorf("unknown type used for body: %+v", obj)
@@ -354,6 +410,10 @@ func (r *Request) URL() *url.URL {
 		p = path.Join(p, r.resourceName)
 	}
 
+	if len(r.subresource) != 0 {
+		p = path.Join(p, r.subresource)
+	}
+
 	finalURL := &url.URL{}
 	if r.c.base != nil {
 		*finalURL = *r.c.base
@@ -10,6 +10,7 @@ type Interface interface {
 	Verb(verb string) *Request
 	Get() *Request
 	Post() *Request
+	Put() *Request
 	Delete() *Request
 }
 
@@ -25,6 +26,7 @@ type RESTClient struct {
 	Client           *http.Client
 	content          ClientContentConfig
 	versionedAPIPath string
+	retry            *RetryPolicy
 }
 
 func NewRESTClient(baseURL *url.URL, versionedAPIPath string, config ClientContentConfig, client *http.Client, opts ...RESTClientOpt) *RESTClient {
@@ -54,6 +56,25 @@ func NewRESTClient(baseURL *url.URL, versionedAPIPath string, config ClientConte
 	return c
 }
 
+// WithTransport wraps http transport of the client (e.g. for tracing).
+// The client is copied, so the original http.Client is not changed
+func WithTransport(wrap func(http.RoundTripper) http.RoundTripper) RESTClientOpt {
+	return func(c *RESTClient) {
+		client := new(http.Client)
+		if c.Client != nil {
+			*client = *c.Client
+		}
+
+		rt := client.Transport
+		if rt == nil {
+			rt = http.DefaultTransport
+		}
+
+		client.Transport = wrap(rt)
+		c.Client = client
+	}
+}
+
 func (c *RESTClient) Verb(verb string) *Request {
 	return NewRequest(c).Verb(verb)
 }
@@ -66,6 +87,10 @@ func (c *RESTClient) Post() *Request {
 	return c.Verb(http.MethodPost)
 }
 
+func (c *RESTClient) Put() *Request {
+	return c.Verb(http.MethodPut)
+}
+
 func (c *RESTClient) Delete() *Request {
 	return c.Verb(http.MethodDelete)
 }
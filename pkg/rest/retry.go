@@ -0,0 +1,195 @@
+package rest
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	DefaultRetryMaxAttempts = 3
+	DefaultRetryBackoff     = time.Second
+	DefaultRetryMaxBackoff  = 30 * time.Second
+)
+
+var DefaultRetryableStatusCodes = []int{
+	http.StatusTooManyRequests,
+	http.StatusInternalServerError,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// DefaultRetryableMethods are idempotent methods. A POST may be applied twice if the response is lost
+// after the server commits, so other methods are retried only if the request is marked idempotent (see Request.Idempotent)
+var DefaultRetryableMethods = []string{
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodOptions,
+	http.MethodPut,
+	http.MethodDelete,
+}
+
+// RetryPolicy describes how failed requests are retried.
+// Network errors and responses with RetryableStatusCodes are retried
+// with exponential backoff and jitter. Retry-After response header takes precedence over backoff.
+// Only requests with RetryableMethods are retried
+type RetryPolicy struct {
+	MaxAttempts          int
+	Backoff              time.Duration
+	MaxBackoff           time.Duration
+	RetryableStatusCodes []int
+	RetryableMethods     []string
+}
+
+func NewRetryPolicy(maxAttempts int, backoff time.Duration) *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts:          maxAttempts,
+		Backoff:              backoff,
+		MaxBackoff:           DefaultRetryMaxBackoff,
+		RetryableStatusCodes: DefaultRetryableStatusCodes,
+		RetryableMethods:     DefaultRetryableMethods,
+	}
+}
+
+func DefaultRetryPolicy() *RetryPolicy {
+	return NewRetryPolicy(DefaultRetryMaxAttempts, DefaultRetryBackoff)
+}
+
+// NoRetry policy makes exactly one attempt
+func NoRetry() *RetryPolicy {
+	return NewRetryPolicy(1, 0)
+}
+
+func WithRetryPolicy(p *RetryPolicy) RESTClientOpt {
+	return func(c *RESTClient) {
+		c.retry = p
+	}
+}
+
+func (p *RetryPolicy) retryable(statusCode int) bool {
+	for _, code := range p.RetryableStatusCodes {
+		if code == statusCode {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *RetryPolicy) retryableMethod(method string) bool {
+	if p == nil {
+		return false
+	}
+	for _, m := range p.RetryableMethods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff returns delay before next attempt (attempt starts from 1)
+func (p *RetryPolicy) backoff(attempt int, resp *http.Response) time.Duration {
+	if d, ok := retryAfter(resp); ok {
+		if p.MaxBackoff > 0 && d > p.MaxBackoff {
+			return p.MaxBackoff
+		}
+		return d
+	}
+
+	d := p.Backoff << (attempt - 1)
+	if d <= 0 || (p.MaxBackoff > 0 && d > p.MaxBackoff) {
+		d = p.MaxBackoff
+	}
+
+	if d <= 0 {
+		return 0
+	}
+
+	// jitter: random delay between d/2 and d
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+
+	value := resp.Header.Get("Retry-After")
+	if len(value) == 0 {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if t, err := http.ParseTime(value); err == nil {
+		d := time.Until(t)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+
+	return 0, false
+}
+
+// Do sends the request created by newRequest and retries it according to policy.
+// newRequest is called before each attempt, so the request body must be replayable
+func (p *RetryPolicy) Do(ctx context.Context, client *http.Client, newRequest func() (*http.Request, error)) (*http.Response, error) {
+
+	maxAttempts := 1
+	if p != nil && p.MaxAttempts > 1 {
+		maxAttempts = p.MaxAttempts
+	}
+
+	for attempt := 1; ; attempt++ {
+		req, err := newRequest()
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := client.Do(req)
+
+		if attempt >= maxAttempts || ctx.Err() != nil {
+			return resp, err
+		}
+
+		if err == nil && !p.retryable(resp.StatusCode) {
+			return resp, nil
+		}
+
+		delay := p.backoff(attempt, resp)
+
+		event := log.Warn().
+			Str("method", req.Method).
+			Str("url", req.URL.Redacted()).
+			Int("attempt", attempt).
+			Dur("delay", delay)
+		if err != nil {
+			event = event.Err(err)
+		} else {
+			event = event.Int("status", resp.StatusCode)
+		}
+		event.Msg("Request failed, retry")
+
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// failingServer responds with status for the first failures requests and with 200 then
+func failingServer(t *testing.T, failures int32, status int, header http.Header) (*httptest.Server, *int32) {
+	t.Helper()
+
+	attempts := new(int32)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(attempts, 1)
+		for k, v := range header {
+			w.Header()[k] = v
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if n <= failures {
+			w.WriteHeader(status)
+			w.Write([]byte(`{}`))
+			return
+		}
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, attempts
+}
+
+func testClient(t *testing.T, srv *httptest.Server, policy *RetryPolicy) *RESTClient {
+	t.Helper()
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewRESTClient(u, "api", ClientContentConfig{}, srv.Client(), WithRetryPolicy(policy))
+}
+
+func TestRetryPolicy(t *testing.T) {
+
+	tests := []struct {
+		name         string
+		failures     int32
+		status       int
+		request      func(c *RESTClient) *Request
+		wantAttempts int32
+		wantErr      bool
+	}{
+		{
+			name:         "get is retried on 503",
+			failures:     2,
+			status:       http.StatusServiceUnavailable,
+			request:      func(c *RESTClient) *Request { return c.Get().Name("entries") },
+			wantAttempts: 3,
+		},
+		{
+			name:         "attempts are limited",
+			failures:     5,
+			status:       http.StatusBadGateway,
+			request:      func(c *RESTClient) *Request { return c.Get().Name("entries") },
+			wantAttempts: 3,
+			wantErr:      true,
+		},
+		{
+			name:         "client error is not retried",
+			failures:     1,
+			status:       http.StatusBadRequest,
+			request:      func(c *RESTClient) *Request { return c.Get().Name("entries") },
+			wantAttempts: 1,
+			wantErr:      true,
+		},
+		{
+			name:         "post is not retried",
+			failures:     1,
+			status:       http.StatusServiceUnavailable,
+			request:      func(c *RESTClient) *Request { return c.Post().Name("entries").Body([]byte(`[]`)) },
+			wantAttempts: 1,
+			wantErr:      true,
+		},
+		{
+			name:     "idempotent post is retried",
+			failures: 1,
+			status:   http.StatusServiceUnavailable,
+			request: func(c *RESTClient) *Request {
+				return c.Post().Idempotent().Name("login").Body([]byte(`{}`))
+			},
+			wantAttempts: 2,
+		},
+		{
+			name:         "delete is retried",
+			failures:     1,
+			status:       http.StatusTooManyRequests,
+			request:      func(c *RESTClient) *Request { return c.Delete().Name("entries") },
+			wantAttempts: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, attempts := failingServer(t, tt.failures, tt.status, nil)
+			c := testClient(t, srv, NewRetryPolicy(3, time.Millisecond))
+
+			err := tt.request(c).Do(context.Background()).Error()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+
+			if got := atomic.LoadInt32(attempts); got != tt.wantAttempts {
+				t.Errorf("got %d attempts, want %d", got, tt.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyNetworkError(t *testing.T) {
+	srv, _ := failingServer(t, 0, http.StatusOK, nil)
+	c := testClient(t, srv, NewRetryPolicy(3, time.Millisecond))
+	srv.Close()
+
+	start := time.Now()
+	if err := c.Get().Name("entries").Do(context.Background()).Error(); err == nil {
+		t.Fatal("expected error")
+	}
+
+	// 3 attempts with 2 backoffs of 0.5-2ms each
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("retries took %s", d)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	header := http.Header{"Retry-After": []string{"1"}}
+	srv, attempts := failingServer(t, 1, http.StatusTooManyRequests, header)
+
+	policy := NewRetryPolicy(2, time.Millisecond)
+	c := testClient(t, srv, policy)
+
+	start := time.Now()
+	if err := c.Get().Name("entries").Do(context.Background()).Error(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := atomic.LoadInt32(attempts); got != 2 {
+		t.Errorf("got %d attempts, want 2", got)
+	}
+
+	if d := time.Since(start); d < time.Second {
+		t.Errorf("Retry-After is ignored, retried after %s", d)
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	p := &RetryPolicy{Backoff: time.Second, MaxBackoff: 5 * time.Second}
+
+	tests := []struct {
+		attempt  int
+		min, max time.Duration
+	}{
+		{attempt: 1, min: 500 * time.Millisecond, max: time.Second},
+		{attempt: 2, min: time.Second, max: 2 * time.Second},
+		{attempt: 3, min: 2 * time.Second, max: 4 * time.Second},
+		// capped by MaxBackoff
+		{attempt: 4, min: 2500 * time.Millisecond, max: 5 * time.Second},
+		{attempt: 100, min: 2500 * time.Millisecond, max: 5 * time.Second},
+	}
+
+	for _, tt := range tests {
+		for i := 0; i < 100; i++ {
+			if d := p.backoff(tt.attempt, nil); d < tt.min || d > tt.max {
+				t.Fatalf("attempt %d: backoff %s is out of [%s, %s]", tt.attempt, d, tt.min, tt.max)
+			}
+		}
+	}
+}
+
+func TestRetryCanceled(t *testing.T) {
+	srv, attempts := failingServer(t, 10, http.StatusServiceUnavailable, nil)
+	c := testClient(t, srv, NewRetryPolicy(10, time.Hour))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if err := c.Get().Name("entries").Do(ctx).Error(); err == nil {
+		t.Fatal("expected error")
+	}
+
+	if got := atomic.LoadInt32(attempts); got != 1 {
+		t.Errorf("got %d attempts, want 1", got)
+	}
+}
@@ -0,0 +1,143 @@
+package rest
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	redacted = "[REDACTED]"
+	// max length of logged body
+	maxTraceBody = 4096
+)
+
+// headers with secrets
+var redactHeaders = []string{
+	"Authorization",
+	"Api-Secret",
+	"Cookie",
+	"Set-Cookie",
+}
+
+// query params with secrets
+var redactParams = []string{
+	"token",
+	"secret",
+}
+
+// json fields with secrets, e.g. "UserToken":"xxx" or "Password":"xxx"
+var reRedactJSON = regexp.MustCompile(`("(?i:usertoken|password|token|secret|api-secret)"\s*:\s*)"(?:[^"\\]|\\.)*"`)
+
+// path segments with secrets, e.g. authorization/request/<token>
+var reRedactPath = regexp.MustCompile(`(/authorization/request/)[^/?]+`)
+
+type traceRoundTripper struct {
+	body bool
+	next http.RoundTripper
+}
+
+// NewTraceRoundTripper returns a transport that logs method, url, status and latency of each request.
+// Request and response bodies are logged if withBody is set.
+// Secrets (auth headers, tokens, passwords) are redacted
+func NewTraceRoundTripper(rt http.RoundTripper, withBody bool) http.RoundTripper {
+	return &traceRoundTripper{
+		body: withBody,
+		next: rt,
+	}
+}
+
+func (rt *traceRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+
+	var reqBody []byte
+	if rt.body && req.Body != nil && req.GetBody != nil {
+		if body, err := req.GetBody(); err == nil {
+			reqBody, _ = io.ReadAll(body)
+			body.Close()
+		}
+	}
+
+	start := time.Now()
+	resp, err := rt.next.RoundTrip(req)
+	latency := time.Since(start)
+
+	event := log.Info().
+		Str("method", req.Method).
+		Str("url", RedactURL(req.URL)).
+		Dur("latency", latency).
+		Interface("requestHeaders", RedactHeader(req.Header))
+
+	if rt.body && len(reqBody) > 0 {
+		event = event.Str("requestBody", RedactBody(reqBody))
+	}
+
+	if err != nil {
+		event.Err(err).Msg("HTTP request failed")
+		return resp, err
+	}
+
+	event = event.Int("status", resp.StatusCode)
+
+	if rt.body && resp.Body != nil {
+		respBody, readErr := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		resp.Body = io.NopCloser(bytes.NewReader(respBody))
+		if readErr != nil {
+			event.Err(readErr).Msg("HTTP request failed")
+			return resp, readErr
+		}
+		event = event.Str("responseBody", RedactBody(respBody))
+	}
+
+	event.Msg("HTTP request")
+
+	return resp, nil
+}
+
+// RedactURL returns url string with secrets replaced
+func RedactURL(u *url.URL) string {
+	redactedURL := *u
+	redactedURL.Path = reRedactPath.ReplaceAllString(u.Path, "${1}"+redacted)
+	redactedURL.RawPath = ""
+
+	query := u.Query()
+	for _, param := range redactParams {
+		if query.Has(param) {
+			query.Set(param, redacted)
+		}
+	}
+	redactedURL.RawQuery = query.Encode()
+
+	return strings.ReplaceAll(redactedURL.Redacted(), url.PathEscape(redacted), redacted)
+}
+
+// RedactHeader returns copy of header with secrets replaced
+func RedactHeader(h http.Header) http.Header {
+	result := h.Clone()
+	for _, key := range redactHeaders {
+		if len(result.Get(key)) == 0 {
+			continue
+		}
+		value := redacted
+		if strings.HasPrefix(result.Get(key), "Bearer ") {
+			value = "Bearer " + redacted
+		}
+		result.Set(key, value)
+	}
+	return result
+}
+
+// RedactBody returns body with json secret fields replaced. Long body is truncated
+func RedactBody(body []byte) string {
+	result := reRedactJSON.ReplaceAllString(string(body), `${1}"`+redacted+`"`)
+	if len(result) > maxTraceBody {
+		result = result[:maxTraceBody] + "...(truncated)"
+	}
+	return result
+}
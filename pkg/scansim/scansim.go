@@ -0,0 +1,180 @@
+// Package scansim simulates unscheduled (on-demand) sensor scans from CGM readings.
+// Scans are drawn from a random source seeded with the local date of the readings,
+// so the same readings always give the same scans
+package scansim
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/blutz1982/go-nsexporter-libreview/pkg/nightscout"
+)
+
+const (
+	StrategyUniform = "uniform"
+	StrategyDaytime = "daytime"
+	StrategyTrend   = "trend"
+
+	DefaultAvgInterval = 90 * time.Minute
+	DefaultDeflection  = 0.3
+	DefaultMaxJitter   = 2 * time.Minute
+
+	// a scan time is matched with the first reading within tolerance
+	matchTolerance = 15 * time.Minute
+)
+
+var Strategies = []string{StrategyUniform, StrategyDaytime, StrategyTrend}
+
+// Scan is a simulated scan of the reading. The scan is Jitter after the reading
+type Scan struct {
+	Entry  *nightscout.GlucoseEntry
+	Jitter time.Duration
+}
+
+// Timestamp returns the scan time
+func (s Scan) Timestamp() time.Time {
+	return s.Entry.Date.Time().Add(s.Jitter)
+}
+
+// Strategy selects scanned readings of one day. entries are readings of the day in ascending order,
+// lastScan is the time of the previous scan (zero if unknown)
+type Strategy interface {
+	Select(day, lastScan time.Time, entries []*nightscout.GlucoseEntry, rnd *rand.Rand) []*nightscout.GlucoseEntry
+}
+
+type Simulator struct {
+	strategy    Strategy
+	seed        int64
+	avgInterval time.Duration
+	deflection  float64
+	maxJitter   time.Duration
+}
+
+type Option func(*Simulator)
+
+// WithAvgInterval sets average interval between scans
+func WithAvgInterval(d time.Duration) Option {
+	return func(s *Simulator) {
+		s.avgInterval = d
+	}
+}
+
+// WithDeflection sets max deflection of interval between scans from the average (0.3 is ±30%)
+func WithDeflection(d float64) Option {
+	return func(s *Simulator) {
+		s.deflection = d
+	}
+}
+
+// WithMaxJitter sets max delay of scan after the reading
+func WithMaxJitter(d time.Duration) Option {
+	return func(s *Simulator) {
+		s.maxJitter = d
+	}
+}
+
+// WithSeed sets seed mixed with the date seed. Different seeds give different scans of the same readings
+func WithSeed(seed int64) Option {
+	return func(s *Simulator) {
+		s.seed = seed
+	}
+}
+
+func New(strategy string, opts ...Option) (*Simulator, error) {
+
+	s := &Simulator{
+		avgInterval: DefaultAvgInterval,
+		deflection:  DefaultDeflection,
+		maxJitter:   DefaultMaxJitter,
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if s.avgInterval <= 0 {
+		return nil, fmt.Errorf("scansim: bad average interval %s", s.avgInterval)
+	}
+
+	if s.deflection < 0 || s.deflection >= 1 {
+		return nil, fmt.Errorf("scansim: bad deflection %v, expected [0, 1)", s.deflection)
+	}
+
+	intervals := intervals{avg: s.avgInterval, deflection: s.deflection}
+
+	switch strategy {
+	case StrategyUniform:
+		s.strategy = &uniform{intervals: intervals}
+	case StrategyDaytime:
+		s.strategy = &daytime{intervals: intervals}
+	case StrategyTrend:
+		s.strategy = &trend{maxInterval: intervals.max()}
+	default:
+		return nil, fmt.Errorf("scansim: unknown strategy %q, expected one of %v", strategy, Strategies)
+	}
+
+	return s, nil
+}
+
+// Seed returns seed of the date (YYYYMMDD of the local day)
+func Seed(date time.Time) int64 {
+	y, m, d := date.Local().Date()
+	return int64(y*10000 + int(m)*100 + d)
+}
+
+// Scans returns scans of the readings in ascending order. Every local day is simulated separately
+// with its own seed, so scans of a day do not depend on the other days in the range.
+// lastScan is the time of the last scan before the readings (e.g. the last exported scan), zero if unknown
+func (s *Simulator) Scans(entries nightscout.GlucoseEntries, lastScan time.Time) []Scan {
+
+	sorted := make([]*nightscout.GlucoseEntry, 0, len(entries))
+	for _, e := range entries {
+		if e.Date != nil {
+			sorted = append(sorted, e)
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Date.Time().Before(sorted[j].Date.Time())
+	})
+
+	var result []Scan
+
+	for start := 0; start < len(sorted); {
+		day := startOfDay(sorted[start].Date.Time())
+		end := start
+		for end < len(sorted) && startOfDay(sorted[end].Date.Time()).Equal(day) {
+			end++
+		}
+
+		rnd := rand.New(rand.NewSource(s.seed ^ Seed(day)))
+
+		for _, e := range s.strategy.Select(day, lastScan, sorted[start:end], rnd) {
+			result = append(result, Scan{
+				Entry:  e,
+				Jitter: s.jitter(e),
+			})
+			lastScan = e.Date.Time()
+		}
+
+		start = end
+	}
+
+	return result
+}
+
+// jitter is seeded with the reading time, so it does not depend on the other readings
+func (s *Simulator) jitter(e *nightscout.GlucoseEntry) time.Duration {
+	if s.maxJitter <= 0 {
+		return 0
+	}
+	rnd := rand.New(rand.NewSource(s.seed ^ e.Date.Time().Unix()))
+	// whole minutes
+	return time.Minute * time.Duration(rnd.Int63n(int64(s.maxJitter/time.Minute)+1))
+}
+
+func startOfDay(ts time.Time) time.Time {
+	y, m, d := ts.Local().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.Local)
+}
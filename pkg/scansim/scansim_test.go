@@ -0,0 +1,261 @@
+package scansim
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/blutz1982/go-nsexporter-libreview/pkg/nightscout"
+)
+
+// the date without DST change, so the local day is 24h in any time zone
+var testDay = time.Date(2024, 2, 5, 0, 0, 0, 0, time.Local)
+
+// readings returns readings every 5 minutes in [from, to), direction of the reading is set by directions
+func readings(from, to time.Time, directions func(ts time.Time) string) (result nightscout.GlucoseEntries) {
+	for ts := from; ts.Before(to); ts = ts.Add(5 * time.Minute) {
+		date := nightscout.NSTime(ts)
+		result = append(result, &nightscout.GlucoseEntry{
+			Date:      &date,
+			Sgv:       100,
+			Direction: directions(ts),
+		})
+	}
+	return
+}
+
+func flat(time.Time) string {
+	return "Flat"
+}
+
+// offsets returns time of scanned readings since day start
+func offsets(day time.Time, scans []Scan) (result []time.Duration) {
+	for _, scan := range scans {
+		result = append(result, scan.Entry.Date.Time().Sub(day))
+	}
+	return
+}
+
+func minutes(values ...int) (result []time.Duration) {
+	for _, v := range values {
+		result = append(result, time.Duration(v)*time.Minute)
+	}
+	return
+}
+
+func TestScansPinned(t *testing.T) {
+
+	entries := readings(testDay, testDay.AddDate(0, 0, 1), flat)
+
+	tests := []struct {
+		strategy string
+		want     []time.Duration
+	}{
+		{
+			strategy: StrategyUniform,
+			want:     minutes(120, 190, 255, 365, 460, 550, 620, 700, 780, 870, 955, 1030, 1110, 1175, 1290, 1395),
+		},
+		{
+			// rare scans at night
+			strategy: StrategyDaytime,
+			want:     minutes(585, 640, 710, 820, 880, 955, 1025, 1090, 1145, 1205, 1280, 1350),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.strategy, func(t *testing.T) {
+			s, err := New(tt.strategy, WithSeed(1))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := offsets(testDay, s.Scans(entries, time.Time{}))
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScansReproducible(t *testing.T) {
+
+	day1 := readings(testDay, testDay.AddDate(0, 0, 1), flat)
+	day2 := readings(testDay.AddDate(0, 0, 1), testDay.AddDate(0, 0, 2), flat)
+	both := append(append(nightscout.GlucoseEntries(nil), day1...), day2...)
+
+	for _, strategy := range []string{StrategyUniform, StrategyDaytime} {
+		t.Run(strategy, func(t *testing.T) {
+			s, err := New(strategy, WithSeed(7))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			first := s.Scans(both, time.Time{})
+			if second := s.Scans(both, time.Time{}); !slices.Equal(offsets(testDay, first), offsets(testDay, second)) {
+				t.Fatal("scans of the same readings differ")
+			}
+
+			// every day is reseeded, scans of a day do not depend on the other days
+			alone := append(s.Scans(day1, time.Time{}), s.Scans(day2, time.Time{})...)
+			if !slices.Equal(offsets(testDay, first), offsets(testDay, alone)) {
+				t.Fatalf("scans of the range %v differ from scans of the days %v", offsets(testDay, first), offsets(testDay, alone))
+			}
+
+			// the days have different seeds
+			if slices.Equal(offsets(testDay, s.Scans(day1, time.Time{})), offsets(testDay.AddDate(0, 0, 1), s.Scans(day2, time.Time{}))) {
+				t.Fatal("scans of different days are the same")
+			}
+
+			other, err := New(strategy, WithSeed(8))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if slices.Equal(offsets(testDay, first), offsets(testDay, other.Scans(both, time.Time{}))) {
+				t.Fatal("scans of different seeds are the same")
+			}
+
+			for _, scan := range first {
+				if scan.Jitter < 0 || scan.Jitter > DefaultMaxJitter || scan.Jitter%time.Minute != 0 {
+					t.Errorf("bad jitter %s", scan.Jitter)
+				}
+			}
+		})
+	}
+}
+
+func TestTrendScans(t *testing.T) {
+
+	// Flat, but FortyFiveUp from 10:00 to 10:30
+	rising := func(ts time.Time) string {
+		if d := ts.Sub(testDay); d >= 10*time.Hour && d < 10*time.Hour+30*time.Minute {
+			return "FortyFiveUp"
+		}
+		return "Flat"
+	}
+
+	tests := []struct {
+		name       string
+		from, to   time.Time
+		directions func(time.Time) string
+		lastScan   time.Time
+		want       []time.Duration
+	}{
+		{
+			// the first reading and every max interval (90m +30% = 117m, readings every 5m)
+			name:       "flat",
+			from:       testDay.Add(8 * time.Hour),
+			to:         testDay.Add(12 * time.Hour),
+			directions: flat,
+			want:       minutes(480, 600),
+		},
+		{
+			name:       "trend change",
+			from:       testDay.Add(9 * time.Hour),
+			to:         testDay.Add(11 * time.Hour),
+			directions: rising,
+			want:       minutes(540, 600, 630),
+		},
+		{
+			// the readings before the last scan are simulated already, the next scan is max interval after it
+			name:       "last scan",
+			from:       testDay.Add(8 * time.Hour),
+			to:         testDay.Add(12 * time.Hour),
+			directions: flat,
+			lastScan:   testDay.Add(9 * time.Hour),
+			want:       minutes(540 + 120),
+		},
+		{
+			// the direction is known from the readings before the last scan
+			name:       "trend change after last scan",
+			from:       testDay.Add(9 * time.Hour),
+			to:         testDay.Add(11 * time.Hour),
+			directions: rising,
+			lastScan:   testDay.Add(10*time.Hour + 10*time.Minute),
+			want:       minutes(630),
+		},
+		{
+			// the last scan of the previous day is kept over midnight
+			name:       "midnight",
+			from:       testDay.Add(23 * time.Hour),
+			to:         testDay.Add(26 * time.Hour),
+			directions: flat,
+			want:       minutes(1380, 1500),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := New(StrategyTrend, WithMaxJitter(0))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := offsets(testDay, s.Scans(readings(tt.from, tt.to, tt.directions), tt.lastScan))
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatch(t *testing.T) {
+
+	// readings at 0, 5, 10, 40, 45 minutes
+	var entries []*nightscout.GlucoseEntry
+	for _, m := range []int{0, 5, 10, 40, 45} {
+		date := nightscout.NSTime(testDay.Add(time.Duration(m) * time.Minute))
+		entries = append(entries, &nightscout.GlucoseEntry{Date: &date})
+	}
+
+	tests := []struct {
+		name  string
+		times []time.Duration
+		want  []time.Duration
+	}{
+		{name: "exact", times: minutes(5), want: minutes(5)},
+		{name: "the first reading after the scan", times: minutes(1), want: minutes(5)},
+		{name: "within tolerance", times: minutes(25), want: minutes(40)},
+		{name: "out of tolerance", times: minutes(24), want: nil},
+		{name: "reading scanned once", times: minutes(1, 2, 26), want: minutes(5, 10, 40)},
+		{name: "after the last reading", times: minutes(46), want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var times []time.Time
+			for _, d := range tt.times {
+				times = append(times, testDay.Add(d))
+			}
+
+			var got []time.Duration
+			for _, e := range match(times, entries) {
+				got = append(got, e.Date.Time().Sub(testDay))
+			}
+
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		strategy string
+		opts     []Option
+	}{
+		{name: "unknown strategy", strategy: "random"},
+		{name: "bad interval", strategy: StrategyUniform, opts: []Option{WithAvgInterval(0)}},
+		{name: "bad deflection", strategy: StrategyUniform, opts: []Option{WithDeflection(1)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(tt.strategy, tt.opts...); err == nil {
+				t.Fatal("error expected")
+			}
+		})
+	}
+}
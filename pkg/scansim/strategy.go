@@ -0,0 +1,114 @@
+package scansim
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/blutz1982/go-nsexporter-libreview/pkg/nightscout"
+)
+
+// intervals draws intervals between scans uniformly from avg±deflection
+type intervals struct {
+	avg        time.Duration
+	deflection float64
+}
+
+func (i intervals) min() time.Duration {
+	return time.Duration(float64(i.avg) * (1 - i.deflection))
+}
+
+func (i intervals) max() time.Duration {
+	return time.Duration(float64(i.avg) * (1 + i.deflection))
+}
+
+func (i intervals) next(rnd *rand.Rand) time.Duration {
+	min, max := i.min(), i.max()
+	if max <= min {
+		return min
+	}
+	return min + time.Duration(rnd.Int63n(int64(max-min)))
+}
+
+// uniform scans all day with intervals avg±deflection
+type uniform struct {
+	intervals intervals
+}
+
+func (u *uniform) Select(day, _ time.Time, entries []*nightscout.GlucoseEntry, rnd *rand.Rand) []*nightscout.GlucoseEntry {
+	var times []time.Time
+	end := day.AddDate(0, 0, 1)
+	for ts := day.Add(u.intervals.next(rnd)); ts.Before(end); ts = ts.Add(u.intervals.next(rnd)) {
+		times = append(times, ts)
+	}
+	return match(times, entries)
+}
+
+// hourly scan rate relative to the average: rare scans at night, frequent at meal times
+var daytimeWeights = [24]float64{
+	0.2, 0.2, 0.2, 0.2, 0.2, 0.3, // 00-06
+	0.8, 1.5, 1.5, 1.2, 1.0, 1.0, // 06-12
+	1.5, 1.5, 1.2, 1.0, 1.0, 1.2, // 12-18
+	1.5, 1.5, 1.2, 1.0, 0.8, 0.5, // 18-24
+}
+
+// daytime scans with intervals avg±deflection divided by the hour weight
+type daytime struct {
+	intervals intervals
+}
+
+func (d *daytime) Select(day, _ time.Time, entries []*nightscout.GlucoseEntry, rnd *rand.Rand) []*nightscout.GlucoseEntry {
+	var times []time.Time
+	end := day.AddDate(0, 0, 1)
+	for ts := day; ; {
+		weight := daytimeWeights[ts.Hour()]
+		ts = ts.Add(time.Duration(float64(d.intervals.next(rnd)) / weight))
+		if !ts.Before(end) {
+			break
+		}
+		times = append(times, ts)
+	}
+	return match(times, entries)
+}
+
+// trend scans at every change of trend direction and at least every maxInterval after the previous scan.
+// Readings up to the previous scan are already simulated, they only set the direction.
+// Without the previous scan the first reading is scanned
+type trend struct {
+	maxInterval time.Duration
+}
+
+func (t *trend) Select(_, lastScan time.Time, entries []*nightscout.GlucoseEntry, _ *rand.Rand) (result []*nightscout.GlucoseEntry) {
+	var direction string
+	for i, e := range entries {
+		ts := e.Date.Time()
+		changed := i > 0 && e.Direction != direction
+		direction = e.Direction
+		if !lastScan.IsZero() && !ts.After(lastScan) {
+			continue
+		}
+		if changed || lastScan.IsZero() || ts.Sub(lastScan) >= t.maxInterval {
+			result = append(result, e)
+			lastScan = ts
+		}
+	}
+	return
+}
+
+// match returns the first reading within matchTolerance after each scan time. entries are in ascending order
+func match(times []time.Time, entries []*nightscout.GlucoseEntry) (result []*nightscout.GlucoseEntry) {
+	i := 0
+	for _, ts := range times {
+		for i < len(entries) && entries[i].Date.Time().Before(ts) {
+			i++
+		}
+		if i == len(entries) {
+			return
+		}
+		if entries[i].Date.Time().Sub(ts) <= matchTolerance {
+			result = append(result, entries[i])
+			// a reading is scanned once
+			i++
+		}
+	}
+	return
+}
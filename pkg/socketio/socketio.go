@@ -0,0 +1,357 @@
+// Package socketio is a minimal socket.io v4 client.
+// Only the engine.io v4 long polling transport and the default namespace are supported
+package socketio
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// engine.io packet types
+	eioOpen    = '0'
+	eioClose   = '1'
+	eioPing    = '2'
+	eioPong    = '3'
+	eioMessage = '4'
+	eioNoop    = '6'
+
+	// socket.io packet types
+	sioConnect      = '0'
+	sioDisconnect   = '1'
+	sioEvent        = '2'
+	sioAck          = '3'
+	sioConnectError = '4'
+
+	// engine.io v4 payload packets separator
+	recordSeparator = "\x1e"
+
+	defaultPath = "socket.io/"
+
+	// socket.io server defaults
+	defaultPingInterval = 25 * time.Second
+	defaultPingTimeout  = 20 * time.Second
+)
+
+var ErrClosed = errors.New("socketio: connection closed by server")
+
+type HandlerFunc func(args []json.RawMessage)
+
+type Client struct {
+	url          *url.URL
+	http         *http.Client
+	sid          string
+	pingInterval time.Duration
+	pingTimeout  time.Duration
+
+	// engine.io does not allow concurrent POST requests
+	sendMu sync.Mutex
+
+	mu       sync.Mutex
+	ackID    int
+	acks     map[int]chan []json.RawMessage
+	handlers map[string]HandlerFunc
+}
+
+type openPacket struct {
+	Sid          string `json:"sid"`
+	PingInterval int    `json:"pingInterval"`
+	PingTimeout  int    `json:"pingTimeout"`
+}
+
+// Dial opens engine.io session and connects to the default namespace
+func Dial(ctx context.Context, baseURL *url.URL, client *http.Client) (*Client, error) {
+
+	u := *baseURL
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + defaultPath
+
+	c := &Client{
+		url:      &u,
+		http:     client,
+		acks:     make(map[int]chan []json.RawMessage),
+		handlers: make(map[string]HandlerFunc),
+	}
+
+	packets, err := c.poll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(packets) == 0 || packets[0][0] != eioOpen {
+		return nil, fmt.Errorf("socketio: unexpected handshake response %q", packets)
+	}
+
+	open := new(openPacket)
+	if err := json.Unmarshal([]byte(packets[0][1:]), open); err != nil {
+		return nil, fmt.Errorf("socketio: bad handshake: %w", err)
+	}
+
+	c.sid = open.Sid
+	c.pingInterval = time.Duration(open.PingInterval) * time.Millisecond
+	c.pingTimeout = time.Duration(open.PingTimeout) * time.Millisecond
+	if c.pingInterval <= 0 {
+		c.pingInterval = defaultPingInterval
+	}
+	if c.pingTimeout <= 0 {
+		c.pingTimeout = defaultPingTimeout
+	}
+
+	if err := c.send(ctx, string([]byte{eioMessage, sioConnect})); err != nil {
+		return nil, err
+	}
+
+	for {
+		packets, err := c.poll(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, p := range packets {
+			switch {
+			case p[0] == eioPing:
+				if err := c.send(ctx, string(eioPong)); err != nil {
+					return nil, err
+				}
+			case p[0] == eioMessage && len(p) > 1 && p[1] == sioConnect:
+				return c, nil
+			case p[0] == eioMessage && len(p) > 1 && p[1] == sioConnectError:
+				return nil, fmt.Errorf("socketio: connect error: %s", p[2:])
+			case p[0] == eioClose:
+				return nil, ErrClosed
+			}
+		}
+	}
+}
+
+// On registers event handler. Handlers are called from Run goroutine
+func (c *Client) On(event string, fn HandlerFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.handlers[event] = fn
+}
+
+// Emit sends event without acknowledgement
+func (c *Client) Emit(ctx context.Context, event string, args ...any) error {
+	data, err := json.Marshal(append([]any{event}, args...))
+	if err != nil {
+		return err
+	}
+	return c.send(ctx, string([]byte{eioMessage, sioEvent})+string(data))
+}
+
+// EmitWithAck sends event and waits for acknowledgement. Run must be started
+func (c *Client) EmitWithAck(ctx context.Context, event string, args ...any) ([]json.RawMessage, error) {
+	data, err := json.Marshal(append([]any{event}, args...))
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan []json.RawMessage, 1)
+
+	c.mu.Lock()
+	id := c.ackID
+	c.ackID++
+	c.acks[id] = ch
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.acks, id)
+		c.mu.Unlock()
+	}()
+
+	if err := c.send(ctx, string([]byte{eioMessage, sioEvent})+strconv.Itoa(id)+string(data)); err != nil {
+		return nil, err
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case args := <-ch:
+		return args, nil
+	}
+}
+
+// Run polls the server and dispatches events until ctx is done or the connection is lost
+func (c *Client) Run(ctx context.Context) error {
+	for {
+		pollCtx, cancel := context.WithTimeout(ctx, c.pingInterval+c.pingTimeout)
+		packets, err := c.poll(pollCtx)
+		cancel()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+
+		for _, p := range packets {
+			if err := c.handle(ctx, p); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Close disconnects from the namespace and closes engine.io session
+func (c *Client) Close(ctx context.Context) error {
+	return c.send(ctx, string([]byte{eioMessage, sioDisconnect}), string(eioClose))
+}
+
+func (c *Client) handle(ctx context.Context, p string) error {
+	if len(p) == 0 {
+		return nil
+	}
+
+	switch p[0] {
+	case eioPing:
+		return c.send(ctx, string(eioPong))
+	case eioClose:
+		return ErrClosed
+	case eioNoop:
+		return nil
+	case eioMessage:
+	default:
+		return nil
+	}
+
+	if len(p) < 2 {
+		return nil
+	}
+
+	switch p[1] {
+	case sioDisconnect:
+		return ErrClosed
+	case sioEvent:
+		_, args, err := parseMessage(p[2:])
+		if err != nil || len(args) == 0 {
+			return nil
+		}
+
+		var event string
+		if err := json.Unmarshal(args[0], &event); err != nil {
+			return nil
+		}
+
+		c.mu.Lock()
+		fn, ok := c.handlers[event]
+		c.mu.Unlock()
+
+		if ok {
+			fn(args[1:])
+		}
+	case sioAck:
+		id, args, err := parseMessage(p[2:])
+		if err != nil || id < 0 {
+			return nil
+		}
+
+		c.mu.Lock()
+		ch, ok := c.acks[id]
+		c.mu.Unlock()
+
+		if ok {
+			ch <- args
+		}
+	}
+
+	return nil
+}
+
+// parseMessage parses [<ack id>]<json array>. ack id is -1 if absent
+func parseMessage(s string) (id int, args []json.RawMessage, err error) {
+	id = -1
+
+	i := strings.IndexByte(s, '[')
+	if i < 0 {
+		return id, nil, fmt.Errorf("socketio: bad message %q", s)
+	}
+
+	if i > 0 {
+		id, err = strconv.Atoi(s[:i])
+		if err != nil {
+			return -1, nil, err
+		}
+	}
+
+	err = json.Unmarshal([]byte(s[i:]), &args)
+	return
+}
+
+func (c *Client) sessionURL() string {
+	u := *c.url
+	query := u.Query()
+	query.Set("EIO", "4")
+	query.Set("transport", "polling")
+	if len(c.sid) > 0 {
+		query.Set("sid", c.sid)
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+func (c *Client) poll(ctx context.Context) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.sessionURL(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var packets []string
+	for _, p := range strings.Split(string(body), recordSeparator) {
+		// skip empty and binary packets
+		if len(p) == 0 || p[0] == 'b' {
+			continue
+		}
+		packets = append(packets, p)
+	}
+
+	return packets, nil
+}
+
+func (c *Client) send(ctx context.Context, packets ...string) error {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.sessionURL(), strings.NewReader(strings.Join(packets, recordSeparator)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain;charset=UTF-8")
+
+	_, err = c.do(req)
+	return err
+}
+
+func (c *Client) do(req *http.Request) ([]byte, error) {
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("socketio: %s %s: status %d: %s", req.Method, req.URL.Path, resp.StatusCode, bytes.TrimSpace(body))
+	}
+
+	return body, nil
+}
@@ -0,0 +1,248 @@
+package socketio
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestParseMessage(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		message  string
+		wantID   int
+		wantArgs []string
+		wantErr  bool
+	}{
+		{name: "event", message: `["dataUpdate",{"delta":true}]`, wantID: -1, wantArgs: []string{`"dataUpdate"`, `{"delta":true}`}},
+		{name: "ack id", message: `12["authorize",{}]`, wantID: 12, wantArgs: []string{`"authorize"`, `{}`}},
+		{name: "no args", message: `[]`, wantID: -1},
+		{name: "empty", message: ``, wantID: -1, wantErr: true},
+		{name: "no array", message: `12`, wantID: -1, wantErr: true},
+		{name: "bad ack id", message: `1x["a"]`, wantID: -1, wantErr: true},
+		{name: "bad json", message: `["a"`, wantID: -1, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, args, err := parseMessage(tt.message)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if id != tt.wantID {
+				t.Errorf("got id %d, want %d", id, tt.wantID)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			var got []string
+			for _, arg := range args {
+				got = append(got, string(arg))
+			}
+			if !slices.Equal(got, tt.wantArgs) {
+				t.Errorf("got args %v, want %v", got, tt.wantArgs)
+			}
+		})
+	}
+}
+
+// postServer records bodies of POST requests (sent packets)
+func postServer(t *testing.T) (*httptest.Server, func() []string) {
+	t.Helper()
+
+	var (
+		mu   sync.Mutex
+		sent []string
+	)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		sent = append(sent, string(body))
+		mu.Unlock()
+		w.Write([]byte("ok"))
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return slices.Clone(sent)
+	}
+}
+
+func TestHandle(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		packet    string
+		wantErr   error
+		wantSent  []string
+		wantEvent []string
+		wantAck   []string
+	}{
+		{name: "empty"},
+		{name: "ping", packet: "2", wantSent: []string{"3"}},
+		{name: "pong", packet: "3"},
+		{name: "noop", packet: "6"},
+		{name: "close", packet: "1", wantErr: ErrClosed},
+		{name: "message without type", packet: "4"},
+		{name: "namespace connect", packet: "40"},
+		{name: "namespace disconnect", packet: "41", wantErr: ErrClosed},
+		{name: "event", packet: `42["dataUpdate",{"delta":true}]`, wantEvent: []string{`{"delta":true}`}},
+		{name: "event with ack id", packet: `427["dataUpdate",1]`, wantEvent: []string{`1`}},
+		{name: "unknown event", packet: `42["other",1]`},
+		{name: "malformed event", packet: `42["dataUpdate"`},
+		{name: "event name not string", packet: `42[1,2]`},
+		{name: "event without args", packet: `42[]`},
+		{name: "ack", packet: `433[{"read":true}]`, wantAck: []string{`{"read":true}`}},
+		{name: "ack without id", packet: `43[{"read":true}]`},
+		{name: "ack of unknown id", packet: `435[{"read":true}]`},
+		{name: "unknown engine.io type", packet: "5"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, sent := postServer(t)
+			u, _ := url.Parse(srv.URL)
+
+			c := &Client{
+				url:      u,
+				http:     srv.Client(),
+				sid:      "sid",
+				acks:     make(map[int]chan []json.RawMessage),
+				handlers: make(map[string]HandlerFunc),
+			}
+
+			var event []string
+			c.On("dataUpdate", func(args []json.RawMessage) {
+				for _, arg := range args {
+					event = append(event, string(arg))
+				}
+			})
+
+			ack := make(chan []json.RawMessage, 1)
+			c.acks[3] = ack
+
+			err := c.handle(context.Background(), tt.packet)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+
+			if got := sent(); !slices.Equal(got, tt.wantSent) {
+				t.Errorf("got sent %q, want %q", got, tt.wantSent)
+			}
+			if !slices.Equal(event, tt.wantEvent) {
+				t.Errorf("got event args %v, want %v", event, tt.wantEvent)
+			}
+
+			var gotAck []string
+			select {
+			case args := <-ack:
+				for _, arg := range args {
+					gotAck = append(gotAck, string(arg))
+				}
+			default:
+			}
+			if !slices.Equal(gotAck, tt.wantAck) {
+				t.Errorf("got ack args %v, want %v", gotAck, tt.wantAck)
+			}
+		})
+	}
+}
+
+// pollingServer is engine.io long polling server. GET without sid is the handshake,
+// other GETs respond with packets of the responses in turn
+func pollingServer(t *testing.T, responses ...string) (*httptest.Server, func() []string) {
+	t.Helper()
+
+	var (
+		mu   sync.Mutex
+		sent []string
+	)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("EIO") != "4" || q.Get("transport") != "polling" || !strings.HasSuffix(r.URL.Path, "/socket.io/") {
+			t.Errorf("bad request %s", r.URL)
+		}
+
+		if r.Method == http.MethodPost {
+			body, _ := io.ReadAll(r.Body)
+			mu.Lock()
+			sent = append(sent, string(body))
+			mu.Unlock()
+			w.Write([]byte("ok"))
+			return
+		}
+
+		if len(q.Get("sid")) == 0 {
+			w.Write([]byte(`0{"sid":"abc","pingInterval":25000,"pingTimeout":20000}`))
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if len(responses) == 0 {
+			w.Write([]byte("1"))
+			return
+		}
+		w.Write([]byte(responses[0]))
+		responses = responses[1:]
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return slices.Clone(sent)
+	}
+}
+
+func TestDial(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		responses []string
+		wantErr   bool
+		wantSent  []string
+	}{
+		{name: "connect", responses: []string{"40"}, wantSent: []string{"40"}},
+		{
+			// several packets in one response
+			name:      "ping before connect",
+			responses: []string{"6", "2\x1e40{\"sid\":\"ns\"}"},
+			wantSent:  []string{"40", "3"},
+		},
+		{name: "connect error", responses: []string{`44{"message":"unauthorized"}`}, wantErr: true, wantSent: []string{"40"}},
+		{name: "closed", responses: []string{"1"}, wantErr: true, wantSent: []string{"40"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, sent := pollingServer(t, tt.responses...)
+			u, _ := url.Parse(srv.URL)
+
+			c, err := Dial(context.Background(), u, srv.Client())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && c.sid != "abc" {
+				t.Errorf("got sid %q", c.sid)
+			}
+			if got := sent(); !slices.Equal(got, tt.wantSent) {
+				t.Errorf("got sent %q, want %q", got, tt.wantSent)
+			}
+		})
+	}
+}
@@ -0,0 +1,319 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// how many upload records are kept in state file
+	MaxUploads = 100
+	// how long uploaded record numbers are kept in ledger
+	LedgerRetention = 90 * 24 * time.Hour
+	// how many sensor sessions (and grid anchors) are kept in state file
+	MaxSensors = 20
+)
+
+// Upload is a record of one successful LibreView import
+type Upload struct {
+	UploadID  string         `json:"uploadId"`
+	CreatedAt time.Time      `json:"createdAt"`
+	Counts    map[string]int `json:"counts,omitempty"`
+}
+
+// SensorSession is a sensor announced to LibreView
+type SensorSession struct {
+	StartedAt   time.Time `json:"startedAt"`
+	Serial      string    `json:"serial,omitempty"`
+	AnnouncedAt time.Time `json:"announcedAt"`
+}
+
+// State is a persistent sync state.
+// Cursors keeps the timestamp of the last exported entry for each measurement type.
+// Ledger keeps the record numbers of uploaded entries (with entry timestamp) for each measurement type.
+// Sensors keeps the last announced sensor sessions.
+// Anchors keeps sensor start times seen in Nightscout (announced or not), they anchor the glucose grid.
+// History keeps srvModified of the last synced document of each Nightscout API v3 collection
+type State struct {
+	mu   sync.Mutex
+	path string
+
+	Cursors map[string]time.Time           `json:"cursors"`
+	Uploads []Upload                       `json:"uploads"`
+	Ledger  map[string]map[int64]time.Time `json:"ledger"`
+	Sensors []SensorSession                `json:"sensors,omitempty"`
+	Anchors []time.Time                    `json:"anchors,omitempty"`
+	History map[string]time.Time           `json:"history,omitempty"`
+}
+
+// New returns empty in-memory state. Save is no-op for such state
+func New() *State {
+	return &State{
+		Cursors: make(map[string]time.Time),
+		Ledger:  make(map[string]map[int64]time.Time),
+		History: make(map[string]time.Time),
+	}
+}
+
+// Load reads state from file. Not existing file is not an error, empty state returned
+func Load(path string) (*State, error) {
+	s := New()
+	s.path = path
+
+	if len(path) == 0 {
+		return s, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return s, nil
+		}
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, err
+	}
+
+	if s.Cursors == nil {
+		s.Cursors = make(map[string]time.Time)
+	}
+
+	if s.Ledger == nil {
+		s.Ledger = make(map[string]map[int64]time.Time)
+	}
+
+	if s.History == nil {
+		s.History = make(map[string]time.Time)
+	}
+
+	return s, nil
+}
+
+func (s *State) Path() string {
+	return s.path
+}
+
+func (s *State) Empty() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.Cursors) == 0
+}
+
+// Cursor returns the timestamp of the last exported entry of measurement type or nil
+func (s *State) Cursor(measurement string) *time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ts, ok := s.Cursors[measurement]
+	if !ok {
+		return nil
+	}
+	return &ts
+}
+
+// SetCursor moves the cursor of measurement type forward. Older timestamps are ignored
+func (s *State) SetCursor(measurement string, ts time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if cur, ok := s.Cursors[measurement]; ok && !ts.After(cur) {
+		return
+	}
+	s.Cursors[measurement] = ts.UTC()
+}
+
+// HistoryCursor returns srvModified of the last synced document of Nightscout collection or nil
+func (s *State) HistoryCursor(collection string) *time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ts, ok := s.History[collection]
+	if !ok {
+		return nil
+	}
+	return &ts
+}
+
+// SetHistoryCursor moves the history cursor of collection forward. Older timestamps are ignored
+func (s *State) SetHistoryCursor(collection string, ts time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if cur, ok := s.History[collection]; ok && !ts.After(cur) {
+		return
+	}
+	s.History[collection] = ts.UTC()
+}
+
+func (s *State) AddUpload(u Upload) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Uploads = append(s.Uploads, u)
+	if len(s.Uploads) > MaxUploads {
+		s.Uploads = s.Uploads[len(s.Uploads)-MaxUploads:]
+	}
+}
+
+// SensorAnnounced reports whether the sensor session started within window around startedAt was announced
+func (s *State) SensorAnnounced(startedAt time.Time, window time.Duration) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, session := range s.Sensors {
+		d := session.StartedAt.Sub(startedAt)
+		if d < 0 {
+			d = -d
+		}
+		if d <= window {
+			return true
+		}
+	}
+	return false
+}
+
+// SerialAnnounced reports whether the sensor with serial was announced
+func (s *State) SerialAnnounced(serial string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, session := range s.Sensors {
+		if session.Serial == serial {
+			return true
+		}
+	}
+	return false
+}
+
+// SensorStarts returns start times of the sensor sessions and anchors
+func (s *State) SensorStarts() []time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := make([]time.Time, 0, len(s.Sensors)+len(s.Anchors))
+	for _, session := range s.Sensors {
+		result = append(result, session.StartedAt)
+	}
+	return append(result, s.Anchors...)
+}
+
+// AddAnchor records the sensor start time. The time within window around a known start is the same sensor,
+// it is not added then. Reports whether the anchor was added
+func (s *State) AddAnchor(startedAt time.Time, window time.Duration) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	near := func(ts time.Time) bool {
+		d := ts.Sub(startedAt)
+		return d > -window && d < window
+	}
+
+	for _, session := range s.Sensors {
+		if near(session.StartedAt) {
+			return false
+		}
+	}
+
+	for _, anchor := range s.Anchors {
+		if near(anchor) {
+			return false
+		}
+	}
+
+	s.Anchors = append(s.Anchors, startedAt.UTC())
+	sort.Slice(s.Anchors, func(i, j int) bool {
+		return s.Anchors[i].Before(s.Anchors[j])
+	})
+	if len(s.Anchors) > MaxSensors {
+		s.Anchors = s.Anchors[len(s.Anchors)-MaxSensors:]
+	}
+	return true
+}
+
+func (s *State) AddSensor(session SensorSession) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Sensors = append(s.Sensors, session)
+	if len(s.Sensors) > MaxSensors {
+		s.Sensors = s.Sensors[len(s.Sensors)-MaxSensors:]
+	}
+}
+
+// Uploaded reports whether the entry with record number was already uploaded
+func (s *State) Uploaded(measurement string, recordNumber int64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.Ledger[measurement][recordNumber]
+	return ok
+}
+
+// AddUploaded records the record number of uploaded entry
+func (s *State) AddUploaded(measurement string, recordNumber int64, ts time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	records, ok := s.Ledger[measurement]
+	if !ok {
+		records = make(map[int64]time.Time)
+		s.Ledger[measurement] = records
+	}
+	records[recordNumber] = ts.UTC()
+}
+
+// pruneLedger removes records of entries older than LedgerRetention
+func (s *State) pruneLedger() {
+	before := time.Now().Add(-LedgerRetention)
+	for _, records := range s.Ledger {
+		for rn, ts := range records {
+			if ts.Before(before) {
+				delete(records, rn)
+			}
+		}
+	}
+}
+
+// Save writes state to file. The file is replaced atomically
+func (s *State) Save() error {
+	if len(s.path) == 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	s.pruneLedger()
+	data, err := json.MarshalIndent(s, "", "  ")
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), s.path)
+}
@@ -0,0 +1,185 @@
+package state
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAddAnchor(t *testing.T) {
+
+	base := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+
+	path := filepath.Join(t.TempDir(), "state.json")
+	s, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.AddSensor(SensorSession{StartedAt: base, Serial: "0M0008B8CTR", AnnouncedAt: base})
+
+	tests := []struct {
+		name string
+		ts   time.Time
+		want bool
+	}{
+		{name: "announced sensor", ts: base.Add(30 * time.Minute), want: false},
+		{name: "new sensor", ts: base.AddDate(0, 0, 14), want: true},
+		{name: "the same sensor", ts: base.AddDate(0, 0, 14).Add(-10 * time.Minute), want: false},
+		{name: "older sensor", ts: base.AddDate(0, 0, -14), want: true},
+	}
+
+	for _, tt := range tests {
+		if got := s.AddAnchor(tt.ts, time.Hour); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	if err := s.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []time.Time{base, base.AddDate(0, 0, -14), base.AddDate(0, 0, 14)}
+	got := loaded.SensorStarts()
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if !got[i].Equal(want[i]) {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+}
+
+func TestSetCursor(t *testing.T) {
+
+	base := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+
+	s := New()
+	if s.Cursor("insulin") != nil {
+		t.Fatal("cursor of empty state")
+	}
+
+	steps := []struct {
+		ts   time.Time
+		want time.Time
+	}{
+		{ts: base, want: base},
+		{ts: base.Add(time.Minute), want: base.Add(time.Minute)},
+		// the cursor never moves back
+		{ts: base, want: base.Add(time.Minute)},
+		{ts: base.Add(time.Minute), want: base.Add(time.Minute)},
+		// stored in UTC
+		{ts: base.Add(time.Hour).In(time.FixedZone("UTC+3", 3*3600)), want: base.Add(time.Hour)},
+	}
+
+	for i, step := range steps {
+		s.SetCursor("insulin", step.ts)
+		got := s.Cursor("insulin")
+		if got == nil || !got.Equal(step.want) || got.Location() != time.UTC {
+			t.Fatalf("step %d: got %v, want %v", i, got, step.want)
+		}
+	}
+
+	if s.Cursor("food") != nil {
+		t.Fatal("cursors of measurement types are shared")
+	}
+}
+
+func TestLedgerSaveLoad(t *testing.T) {
+
+	now := time.Now().UTC().Truncate(time.Second)
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	s, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.Empty() {
+		t.Fatal("state of not existing file is not empty")
+	}
+
+	s.SetCursor("scheduledContinuousGlucose", now)
+	s.AddUploaded("scheduledContinuousGlucose", 1, now)
+	s.AddUploaded("insulin", 2, now.Add(-time.Hour))
+	// older than retention
+	s.AddUploaded("insulin", 3, now.Add(-LedgerRetention-time.Hour))
+	s.AddUpload(Upload{UploadID: "u1", CreatedAt: now, Counts: map[string]int{"insulin": 1}})
+
+	if !s.Uploaded("insulin", 3) {
+		t.Fatal("the record is pruned before save")
+	}
+
+	if err := s.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		measurement  string
+		recordNumber int64
+		want         bool
+	}{
+		{"scheduledContinuousGlucose", 1, true},
+		{"insulin", 2, true},
+		{"insulin", 3, false},
+		// ledgers of measurement types are separate
+		{"food", 2, false},
+		{"insulin", 1, false},
+	}
+
+	for _, tt := range tests {
+		if got := loaded.Uploaded(tt.measurement, tt.recordNumber); got != tt.want {
+			t.Errorf("%s %d: got %v, want %v", tt.measurement, tt.recordNumber, got, tt.want)
+		}
+	}
+
+	if cursor := loaded.Cursor("scheduledContinuousGlucose"); cursor == nil || !cursor.Equal(now) {
+		t.Errorf("got cursor %v, want %v", cursor, now)
+	}
+
+	if len(loaded.Uploads) != 1 || loaded.Uploads[0].UploadID != "u1" {
+		t.Errorf("got uploads %v", loaded.Uploads)
+	}
+}
+
+func TestAddUploadLimit(t *testing.T) {
+	s := New()
+	for i := 0; i < MaxUploads+5; i++ {
+		s.AddUpload(Upload{UploadID: fmt.Sprint(i)})
+	}
+	if len(s.Uploads) != MaxUploads || s.Uploads[0].UploadID != "5" {
+		t.Fatalf("got %d uploads from %s", len(s.Uploads), s.Uploads[0].UploadID)
+	}
+}
+
+func TestSerialAnnounced(t *testing.T) {
+
+	s := New()
+	s.AddSensor(SensorSession{StartedAt: time.Now(), Serial: "0M0008B8CTR"})
+	s.AddSensor(SensorSession{StartedAt: time.Now()})
+
+	tests := []struct {
+		serial string
+		want   bool
+	}{
+		{serial: "0M0008B8CTR", want: true},
+		{serial: "0M0008B8CTS"},
+	}
+
+	for _, tt := range tests {
+		if got := s.SerialAnnounced(tt.serial); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.serial, got, tt.want)
+		}
+	}
+}
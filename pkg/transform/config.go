@@ -0,0 +1,83 @@
+package transform
+
+import (
+	"github.com/blutz1982/go-nsexporter-libreview/pkg/libreview"
+	"github.com/blutz1982/go-nsexporter-libreview/pkg/nightscout"
+)
+
+const (
+	DefaultAlarmLow           = 70
+	DefaultAlarmHigh          = 240
+	DefaultKetoneNotesPattern = `(?i)ketones?\s*[:=]?\s*([0-9]+(?:[.,][0-9]+)?)`
+)
+
+var DefaultKetoneEventTypes = []string{"Note", "Ketones"}
+
+var DefaultFoodEventTypes = map[string]string{
+	nightscout.EventTypeSnackBolus:     libreview.FoodTypeSnack,
+	nightscout.EventTypeCarbCorrection: libreview.FoodTypeSnack,
+}
+
+var DefaultMealTimes = []MealTime{
+	{FoodType: libreview.FoodTypeBreakfast, From: "05:00", To: "11:00"},
+	{FoodType: libreview.FoodTypeLunch, From: "11:00", To: "16:00"},
+	{FoodType: libreview.FoodTypeDinner, From: "16:00", To: "22:00"},
+	{FoodType: libreview.FoodTypeSnack, From: "22:00", To: "05:00"},
+}
+
+type Config struct {
+	Ketone KetoneConfig `yaml:"ketone"`
+	Alarms AlarmsConfig `yaml:"alarms"`
+	// Insulins are added to the default insulin catalog (nightscout.DefaultInsulinTypes)
+	Insulins []nightscout.InsulinType `yaml:"insulins"`
+	Food     FoodConfig               `yaml:"food"`
+}
+
+// FoodConfig is a table of LibreView food types (Breakfast, Lunch, Dinner, Snack, Unknown) for carb treatments.
+// The foodType of the treatment is used if it is a LibreView food type, then the event type, then the time of day
+type FoodConfig struct {
+	// EventTypes maps treatment event type to food type
+	EventTypes map[string]string `yaml:"eventTypes"`
+	// MealTimes maps local time of day to food type
+	MealTimes []MealTime `yaml:"mealTimes"`
+}
+
+// MealTime is a time of day range [From, To) in HH:MM. The range may cross midnight
+type MealTime struct {
+	FoodType string `yaml:"foodType"`
+	From     string `yaml:"from"`
+	To       string `yaml:"to"`
+}
+
+// AlarmsConfig is glucose thresholds (mg/dL) for low and high alarms.
+// An alarm is reported when glucose crosses the threshold. A zero threshold is
+// DefaultAlarmLow (DefaultAlarmHigh), a negative one disables the alarm
+type AlarmsConfig struct {
+	Low  float64 `yaml:"low"`
+	High float64 `yaml:"high"`
+}
+
+// KetoneConfig is a rule for recognizing blood ketone readings in treatments
+type KetoneConfig struct {
+	// EventTypes of treatments with ketone readings
+	EventTypes []string `yaml:"eventTypes"`
+	// NotesPattern is a regexp for treatment notes. The first group is the value in mmol/L
+	NotesPattern string `yaml:"notesPattern"`
+}
+
+func DefaultConfig() *Config {
+	return &Config{
+		Ketone: KetoneConfig{
+			EventTypes:   DefaultKetoneEventTypes,
+			NotesPattern: DefaultKetoneNotesPattern,
+		},
+		Alarms: AlarmsConfig{
+			Low:  DefaultAlarmLow,
+			High: DefaultAlarmHigh,
+		},
+		Food: FoodConfig{
+			EventTypes: DefaultFoodEventTypes,
+			MealTimes:  DefaultMealTimes,
+		},
+	}
+}
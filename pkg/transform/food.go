@@ -0,0 +1,129 @@
+package transform
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/blutz1982/go-nsexporter-libreview/pkg/libreview"
+	"github.com/blutz1982/go-nsexporter-libreview/pkg/nightscout"
+)
+
+type mealTime struct {
+	foodType string
+	// minutes of day
+	from, to int
+}
+
+func (m mealTime) contains(minute int) bool {
+	if m.from <= m.to {
+		return minute >= m.from && minute < m.to
+	}
+	return minute >= m.from || minute < m.to
+}
+
+// FoodTypeRule classifies carb treatments into LibreView food types
+type FoodTypeRule struct {
+	eventTypes map[string]string
+	mealTimes  []mealTime
+}
+
+// NewFoodTypeRule checks the food config. Empty fields are replaced with defaults
+func NewFoodTypeRule(cfg FoodConfig) (*FoodTypeRule, error) {
+
+	eventTypes := cfg.EventTypes
+	if len(eventTypes) == 0 {
+		eventTypes = DefaultFoodEventTypes
+	}
+
+	mealTimes := cfg.MealTimes
+	if len(mealTimes) == 0 {
+		mealTimes = DefaultMealTimes
+	}
+
+	rule := &FoodTypeRule{
+		eventTypes: make(map[string]string),
+	}
+
+	for eventType, foodType := range eventTypes {
+		ft, ok := libreFoodType(foodType)
+		if !ok {
+			return nil, fmt.Errorf("bad food type %q of event type %q, expected one of %s", foodType, eventType, strings.Join(libreview.FoodTypes, ", "))
+		}
+		rule.eventTypes[strings.ToLower(eventType)] = ft
+	}
+
+	for _, m := range mealTimes {
+		ft, ok := libreFoodType(m.FoodType)
+		if !ok {
+			return nil, fmt.Errorf("bad meal time food type %q, expected one of %s", m.FoodType, strings.Join(libreview.FoodTypes, ", "))
+		}
+		from, err := parseTimeOfDay(m.From)
+		if err != nil {
+			return nil, fmt.Errorf("bad meal time %s from: %w", m.FoodType, err)
+		}
+		to, err := parseTimeOfDay(m.To)
+		if err != nil {
+			return nil, fmt.Errorf("bad meal time %s to: %w", m.FoodType, err)
+		}
+		rule.mealTimes = append(rule.mealTimes, mealTime{foodType: ft, from: from, to: to})
+	}
+
+	return rule, nil
+}
+
+// FoodType returns LibreView food type of the treatment or Unknown
+func (r *FoodTypeRule) FoodType(t *nightscout.Treatment) string {
+
+	if ft, ok := libreFoodType(t.FoodType); ok {
+		return ft
+	}
+
+	if ft, ok := r.eventTypes[strings.ToLower(t.EventType)]; ok {
+		return ft
+	}
+
+	ts := t.CreatedAt.Local()
+	minute := ts.Hour()*60 + ts.Minute()
+	for _, m := range r.mealTimes {
+		if m.contains(minute) {
+			return m.foodType
+		}
+	}
+
+	return libreview.FoodTypeUnknown
+}
+
+// libreFoodType returns LibreView food type in canonical case
+func libreFoodType(s string) (string, bool) {
+	for _, ft := range libreview.FoodTypes {
+		if strings.EqualFold(strings.TrimSpace(s), ft) {
+			return ft, true
+		}
+	}
+	return "", false
+}
+
+func parseTimeOfDay(s string) (int, error) {
+	ts, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, err
+	}
+	return ts.Hour()*60 + ts.Minute(), nil
+}
+
+// NSToLibreFoodEntry returns food entry with carbs rounded to grams.
+// Protein and fat are not supported by LibreView
+func NSToLibreFoodEntry(t *nightscout.Treatment, rule *FoodTypeRule) *libreview.FoodEntry {
+	return &libreview.FoodEntry{
+		ExtendedProperties: libreview.TreatmentExtendedProperties{
+			FactoryTimestamp: t.CreatedAt,
+		},
+		RecordNumber: libreview.RecordNumberIncrementFood + t.CreatedAt.Unix(),
+		Timestamp:    t.CreatedAt.Local(),
+		GramsCarbs:   int(math.Round(t.Carbs)),
+		FoodType:     rule.FoodType(t),
+		SourceID:     t.ID,
+	}
+}
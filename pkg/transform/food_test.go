@@ -0,0 +1,100 @@
+package transform
+
+import (
+	"testing"
+	"time"
+
+	"github.com/blutz1982/go-nsexporter-libreview/pkg/libreview"
+	"github.com/blutz1982/go-nsexporter-libreview/pkg/nightscout"
+)
+
+func TestFoodTypeRule(t *testing.T) {
+
+	// meal times are local time of day
+	at := func(hour, minute int) time.Time {
+		return time.Date(2024, 3, 10, hour, minute, 0, 0, time.Local)
+	}
+
+	tests := []struct {
+		name      string
+		cfg       FoodConfig
+		eventType string
+		foodType  string
+		ts        time.Time
+		want      string
+	}{
+		{name: "breakfast", eventType: "Meal Bolus", ts: at(7, 30), want: libreview.FoodTypeBreakfast},
+		{name: "lunch from", eventType: "Meal Bolus", ts: at(11, 0), want: libreview.FoodTypeLunch},
+		{name: "dinner", eventType: "Meal Bolus", ts: at(21, 59), want: libreview.FoodTypeDinner},
+		{name: "snack after midnight", eventType: "Meal Bolus", ts: at(0, 30), want: libreview.FoodTypeSnack},
+		{name: "snack before midnight", eventType: "Meal Bolus", ts: at(23, 0), want: libreview.FoodTypeSnack},
+		{name: "event type", eventType: "Snack Bolus", ts: at(12, 0), want: libreview.FoodTypeSnack},
+		{name: "event type case", eventType: "carb correction", ts: at(8, 0), want: libreview.FoodTypeSnack},
+		{name: "treatment food type", eventType: "Snack Bolus", foodType: " dinner ", ts: at(8, 0), want: libreview.FoodTypeDinner},
+		{name: "unknown treatment food type", eventType: "Meal Bolus", foodType: "Brunch", ts: at(12, 0), want: libreview.FoodTypeLunch},
+		{
+			name:      "custom meal times with gap",
+			cfg:       FoodConfig{MealTimes: []MealTime{{FoodType: "breakfast", From: "06:00", To: "09:00"}}},
+			eventType: "Meal Bolus",
+			ts:        at(12, 0),
+			want:      libreview.FoodTypeUnknown,
+		},
+		{
+			name:      "custom event types",
+			cfg:       FoodConfig{EventTypes: map[string]string{"Meal Bolus": "Lunch"}},
+			eventType: "Meal Bolus",
+			ts:        at(20, 0),
+			want:      libreview.FoodTypeLunch,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := NewFoodTypeRule(tt.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := rule.FoodType(&nightscout.Treatment{EventType: tt.eventType, FoodType: tt.foodType, CreatedAt: tt.ts})
+			if got != tt.want {
+				t.Fatalf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewFoodTypeRuleErrors(t *testing.T) {
+
+	tests := []struct {
+		name string
+		cfg  FoodConfig
+	}{
+		{name: "bad event food type", cfg: FoodConfig{EventTypes: map[string]string{"Meal Bolus": "Brunch"}}},
+		{name: "bad meal food type", cfg: FoodConfig{MealTimes: []MealTime{{FoodType: "Brunch", From: "10:00", To: "12:00"}}}},
+		{name: "bad from", cfg: FoodConfig{MealTimes: []MealTime{{FoodType: "Lunch", From: "25:00", To: "12:00"}}}},
+		{name: "bad to", cfg: FoodConfig{MealTimes: []MealTime{{FoodType: "Lunch", From: "11:00", To: "noon"}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewFoodTypeRule(tt.cfg); err == nil {
+				t.Fatal("error expected")
+			}
+		})
+	}
+}
+
+func TestNSToLibreFoodEntryRoundsCarbs(t *testing.T) {
+
+	rule, err := NewFoodTypeRule(FoodConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for carbs, want := range map[float64]int{7.5: 8, 7.4: 7, 12: 12} {
+		entry := NSToLibreFoodEntry(&nightscout.Treatment{Carbs: carbs, CreatedAt: time.Now()}, rule)
+		if entry.GramsCarbs != want {
+			t.Errorf("carbs %v: got %d, want %d", carbs, entry.GramsCarbs, want)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package transform
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/blutz1982/go-nsexporter-libreview/pkg/libreview"
+	"github.com/blutz1982/go-nsexporter-libreview/pkg/nightscout"
+)
+
+func NSExerciseToLibreGenericEntry(t *nightscout.Treatment) *libreview.GenericEntry {
+	return &libreview.GenericEntry{
+		Type: libreview.GenericTypeExercise,
+		ExtendedProperties: libreview.ExerciseExtendedProperties{
+			FactoryTimestamp:  t.CreatedAt.UTC(),
+			DurationInMinutes: int(t.Duration),
+		},
+		RecordNumber: libreview.GenericRecordNumber(libreview.GenericTypeExercise, t.CreatedAt),
+		Timestamp:    t.CreatedAt.Local(),
+	}
+}
+
+func NSNoteToLibreGenericEntry(t *nightscout.Treatment) *libreview.GenericEntry {
+	return &libreview.GenericEntry{
+		Type: libreview.GenericTypeCustomNote,
+		ExtendedProperties: libreview.CustomNoteExtendedProperties{
+			FactoryTimestamp: t.CreatedAt.UTC(),
+			Text:             strings.TrimSpace(t.Notes),
+		},
+		RecordNumber: libreview.GenericRecordNumber(libreview.GenericTypeCustomNote, t.CreatedAt),
+		Timestamp:    t.CreatedAt.Local(),
+	}
+}
+
+// IsNote reports whether the treatment is a note or an announcement with text
+func IsNote(t *nightscout.Treatment) bool {
+	switch t.EventType {
+	case nightscout.EventTypeNote, nightscout.EventTypeAnnouncement:
+		return len(strings.TrimSpace(t.Notes)) > 0
+	default:
+		return false
+	}
+}
+
+// NSToLibreAlarmEntries returns low and high alarms for glucose entries crossing the thresholds.
+// The first entry below low (or above high) threshold after an entry in range is the alarm.
+// Zero thresholds are replaced with defaults, negative disable the alarm
+func NSToLibreAlarmEntries(entries nightscout.GlucoseEntries, cfg AlarmsConfig) (result libreview.GenericEntries) {
+
+	lowThreshold := cfg.Low
+	if lowThreshold == 0 {
+		lowThreshold = DefaultAlarmLow
+	}
+
+	highThreshold := cfg.High
+	if highThreshold == 0 {
+		highThreshold = DefaultAlarmHigh
+	}
+
+	sorted := make(nightscout.GlucoseEntries, 0, entries.Len())
+	entries.Visit(func(e *nightscout.GlucoseEntry, _ error) error {
+		if e.Date != nil {
+			sorted.Append(e)
+		}
+		return nil
+	})
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Date.Time().Before(sorted[j].Date.Time())
+	})
+
+	var low, high bool
+
+	for i, e := range sorted {
+		value := e.Sgv.Float64()
+
+		isLow := lowThreshold > 0 && value < lowThreshold
+		isHigh := highThreshold > 0 && value > highThreshold
+
+		// the state before the first entry is unknown
+		if i > 0 {
+			if isLow && !low {
+				result.Append(newLibreAlarmEntry(libreview.GenericTypeAlarmLow, e, lowThreshold))
+			}
+			if isHigh && !high {
+				result.Append(newLibreAlarmEntry(libreview.GenericTypeAlarmHigh, e, highThreshold))
+			}
+		}
+
+		low, high = isLow, isHigh
+	}
+
+	return
+}
+
+func newLibreAlarmEntry(alarmType string, e *nightscout.GlucoseEntry, threshold float64) *libreview.GenericEntry {
+	ts := e.Date.Time()
+	return &libreview.GenericEntry{
+		Type: alarmType,
+		ExtendedProperties: libreview.AlarmExtendedProperties{
+			FactoryTimestamp:   ts.UTC(),
+			GlucoseInMgPerDl:   e.Sgv.Float64(),
+			ThresholdInMgPerDl: threshold,
+		},
+		RecordNumber: libreview.GenericRecordNumber(alarmType, ts),
+		Timestamp:    ts.Local(),
+	}
+}
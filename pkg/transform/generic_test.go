@@ -0,0 +1,144 @@
+package transform
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/blutz1982/go-nsexporter-libreview/pkg/libreview"
+	"github.com/blutz1982/go-nsexporter-libreview/pkg/nightscout"
+)
+
+var testTime = time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+
+// readings returns glucose entries every 5 minutes
+func readings(values ...float64) (result nightscout.GlucoseEntries) {
+	for i, v := range values {
+		date := nightscout.NSTime(testTime.Add(time.Duration(i) * 5 * time.Minute))
+		result = append(result, &nightscout.GlucoseEntry{Date: &date, Sgv: nightscout.SVG(v)})
+	}
+	return
+}
+
+func TestNSToLibreAlarmEntries(t *testing.T) {
+
+	type alarm struct {
+		alarmType string
+		// index of the reading
+		reading   int
+		threshold float64
+	}
+
+	const (
+		low  = libreview.GenericTypeAlarmLow
+		high = libreview.GenericTypeAlarmHigh
+	)
+
+	cfg := AlarmsConfig{Low: 70, High: 180}
+
+	tests := []struct {
+		name    string
+		values  []float64
+		cfg     AlarmsConfig
+		reverse bool
+		want    []alarm
+	}{
+		{name: "in range", values: []float64{100, 120, 110}, cfg: cfg},
+		{name: "entering low", values: []float64{100, 65, 60}, cfg: cfg, want: []alarm{{low, 1, 70}}},
+		{name: "leaving low", values: []float64{60, 65, 100}, cfg: cfg},
+		{name: "several crossings", values: []float64{100, 60, 100, 60, 200, 100, 190}, cfg: cfg, want: []alarm{{low, 1, 70}, {low, 3, 70}, {high, 4, 180}, {high, 6, 180}}},
+		{name: "low to high", values: []float64{100, 60, 200}, cfg: cfg, want: []alarm{{low, 1, 70}, {high, 2, 180}}},
+		{name: "on the threshold", values: []float64{100, 70, 180, 69, 181}, cfg: cfg, want: []alarm{{low, 3, 70}, {high, 4, 180}}},
+		{name: "the first reading", values: []float64{60, 200}, cfg: cfg, want: []alarm{{high, 1, 180}}},
+		{name: "unsorted", values: []float64{100, 60}, cfg: cfg, reverse: true, want: []alarm{{low, 1, 70}}},
+		{name: "default thresholds", values: []float64{100, 69, 100, 241}, want: []alarm{{low, 1, DefaultAlarmLow}, {high, 3, DefaultAlarmHigh}}},
+		{name: "disabled", values: []float64{100, 40, 100, 300}, cfg: AlarmsConfig{Low: -1, High: -1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries := readings(tt.values...)
+			if tt.reverse {
+				slices.Reverse(entries)
+			}
+
+			var got []alarm
+			for _, e := range NSToLibreAlarmEntries(entries, tt.cfg) {
+				props := e.ExtendedProperties.(libreview.AlarmExtendedProperties)
+				got = append(got, alarm{e.Type, int(e.Timestamp.Sub(testTime) / (5 * time.Minute)), props.ThresholdInMgPerDl})
+
+				if props.GlucoseInMgPerDl != tt.values[int(e.Timestamp.Sub(testTime)/(5*time.Minute))] {
+					t.Errorf("got glucose %v", props.GlucoseInMgPerDl)
+				}
+				if e.RecordNumber != libreview.GenericRecordNumber(e.Type, e.Timestamp) {
+					t.Errorf("got record number %d", e.RecordNumber)
+				}
+			}
+
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNSExerciseToLibreGenericEntry(t *testing.T) {
+
+	e := NSExerciseToLibreGenericEntry(&nightscout.Treatment{
+		EventType: nightscout.EventTypeExercise,
+		CreatedAt: testTime,
+		Duration:  45,
+	})
+
+	props, ok := e.ExtendedProperties.(libreview.ExerciseExtendedProperties)
+	if !ok || e.Type != libreview.GenericTypeExercise {
+		t.Fatalf("got %s entry with %T", e.Type, e.ExtendedProperties)
+	}
+	if props.DurationInMinutes != 45 || !props.FactoryTimestamp.Equal(testTime) || !e.Timestamp.Equal(testTime) {
+		t.Fatalf("got %+v at %s", props, e.Timestamp)
+	}
+	if e.RecordNumber != libreview.GenericRecordNumber(libreview.GenericTypeExercise, testTime) {
+		t.Fatalf("got record number %d", e.RecordNumber)
+	}
+}
+
+func TestNSNoteToLibreGenericEntry(t *testing.T) {
+
+	e := NSNoteToLibreGenericEntry(&nightscout.Treatment{
+		EventType: nightscout.EventTypeNote,
+		CreatedAt: testTime,
+		Notes:     "  pizza \n",
+	})
+
+	props, ok := e.ExtendedProperties.(libreview.CustomNoteExtendedProperties)
+	if !ok || e.Type != libreview.GenericTypeCustomNote {
+		t.Fatalf("got %s entry with %T", e.Type, e.ExtendedProperties)
+	}
+	if props.Text != "pizza" || !props.FactoryTimestamp.Equal(testTime) {
+		t.Fatalf("got %+v", props)
+	}
+	if e.RecordNumber != libreview.GenericRecordNumber(libreview.GenericTypeCustomNote, testTime) {
+		t.Fatalf("got record number %d", e.RecordNumber)
+	}
+}
+
+func TestIsNote(t *testing.T) {
+
+	tests := []struct {
+		eventType string
+		notes     string
+		want      bool
+	}{
+		{eventType: nightscout.EventTypeNote, notes: "pizza", want: true},
+		{eventType: nightscout.EventTypeAnnouncement, notes: "pump site change", want: true},
+		{eventType: nightscout.EventTypeNote, notes: "  "},
+		{eventType: nightscout.EventTypeExercise, notes: "run"},
+		{eventType: "Meal Bolus", notes: "pizza"},
+	}
+
+	for _, tt := range tests {
+		if got := IsNote(&nightscout.Treatment{EventType: tt.eventType, Notes: tt.notes}); got != tt.want {
+			t.Errorf("%s %q: got %v, want %v", tt.eventType, tt.notes, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package transform
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/blutz1982/go-nsexporter-libreview/pkg/libreview"
+	"github.com/blutz1982/go-nsexporter-libreview/pkg/nightscout"
+)
+
+const (
+	// blood ketone meter range, mmol/L
+	ketoneMin = 0.0
+	ketoneMax = 8.0
+)
+
+// KetoneRule recognizes ketone readings in treatments
+type KetoneRule struct {
+	eventTypes map[string]struct{}
+	re         *regexp.Regexp
+}
+
+// NewKetoneRule compiles the rule. Empty fields are replaced with defaults
+func NewKetoneRule(cfg KetoneConfig) (*KetoneRule, error) {
+
+	eventTypes := cfg.EventTypes
+	if len(eventTypes) == 0 {
+		eventTypes = DefaultKetoneEventTypes
+	}
+
+	pattern := cfg.NotesPattern
+	if len(pattern) == 0 {
+		pattern = DefaultKetoneNotesPattern
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("bad ketone notesPattern: %w", err)
+	}
+
+	if re.NumSubexp() < 1 {
+		return nil, fmt.Errorf("bad ketone notesPattern %q: the value group is missing", pattern)
+	}
+
+	rule := &KetoneRule{
+		eventTypes: make(map[string]struct{}),
+		re:         re,
+	}
+
+	for _, t := range eventTypes {
+		rule.eventTypes[strings.ToLower(t)] = struct{}{}
+	}
+
+	return rule, nil
+}
+
+// Match returns ketone value (mmol/L) of the treatment
+func (r *KetoneRule) Match(t *nightscout.Treatment) (float64, bool) {
+
+	if _, ok := r.eventTypes[strings.ToLower(t.EventType)]; !ok {
+		return 0, false
+	}
+
+	m := r.re.FindStringSubmatch(t.Notes)
+	if len(m) < 2 {
+		return 0, false
+	}
+
+	value, err := strconv.ParseFloat(strings.Replace(m[1], ",", ".", 1), 64)
+	if err != nil || value < 0 {
+		return 0, false
+	}
+
+	return value, true
+}
+
+func NSToLibreKetoneEntry(t *nightscout.Treatment, mmolPerL float64) *libreview.KetoneEntry {
+	return &libreview.KetoneEntry{
+		ValueInMmolPerL: mmolPerL,
+		ExtendedProperties: libreview.KetoneExtendedProperties{
+			FactoryTimestamp:       t.CreatedAt.UTC(),
+			LowOutOfRange:          strconv.FormatBool(mmolPerL <= ketoneMin),
+			HighOutOfRange:         strconv.FormatBool(mmolPerL >= ketoneMax),
+			IsFirstAfterTimeChange: false,
+		},
+		RecordNumber: libreview.RecordNumberIncrementKetone + t.CreatedAt.Unix(),
+		Timestamp:    t.CreatedAt.Local(),
+	}
+}
@@ -0,0 +1,75 @@
+package transform
+
+import (
+	"testing"
+
+	"github.com/blutz1982/go-nsexporter-libreview/pkg/nightscout"
+)
+
+func TestKetoneRuleMatch(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		cfg       KetoneConfig
+		eventType string
+		notes     string
+		want      float64
+		wantOK    bool
+	}{
+		{name: "note", eventType: "Note", notes: "Ketones 0.6", want: 0.6, wantOK: true},
+		{name: "ketones event type", eventType: "Ketones", notes: "ketone: 1.2", want: 1.2, wantOK: true},
+		{name: "event type case", eventType: "note", notes: "KETONES=0.3", want: 0.3, wantOK: true},
+		{name: "decimal comma", eventType: "Note", notes: "ketones 1,5 after run", want: 1.5, wantOK: true},
+		{name: "integer", eventType: "Note", notes: "ketones 2", want: 2, wantOK: true},
+		{name: "other event type", eventType: "Meal Bolus", notes: "ketones 0.6"},
+		{name: "no value", eventType: "Note", notes: "check ketones"},
+		{name: "no notes", eventType: "Note"},
+		{
+			name:      "custom config",
+			cfg:       KetoneConfig{EventTypes: []string{"BHB"}, NotesPattern: `bhb\s+([0-9.]+)`},
+			eventType: "BHB",
+			notes:     "bhb 0.4",
+			want:      0.4,
+			wantOK:    true,
+		},
+		{
+			name:      "custom event types replace defaults",
+			cfg:       KetoneConfig{EventTypes: []string{"BHB"}},
+			eventType: "Note",
+			notes:     "ketones 0.6",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := NewKetoneRule(tt.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, ok := rule.Match(&nightscout.Treatment{EventType: tt.eventType, Notes: tt.notes})
+			if ok != tt.wantOK || got != tt.want {
+				t.Fatalf("got %v, %v, want %v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestNewKetoneRuleBadPattern(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		pattern string
+	}{
+		{name: "not compiled", pattern: `ketones (`},
+		{name: "no value group", pattern: `ketones [0-9.]+`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewKetoneRule(KetoneConfig{NotesPattern: tt.pattern}); err == nil {
+				t.Fatal("error expected")
+			}
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package transform
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/blutz1982/go-nsexporter-libreview/pkg/nightscout"
+)
+
+// Libre sensor serial number (e.g. 0M0008B8CTR)
+var reSensorSerial = regexp.MustCompile(`\b[0-9A-Z]{10,11}\b`)
+
+// IsSensorStart reports whether the treatment is a sensor insertion
+func IsSensorStart(t *nightscout.Treatment) bool {
+	switch t.EventType {
+	case nightscout.EventTypeSensorStart, nightscout.EventTypeSensorChange:
+		return true
+	default:
+		return false
+	}
+}
+
+// SensorSerial returns sensor serial number from treatment notes or empty string.
+// The serial must contain both digits and letters
+func SensorSerial(t *nightscout.Treatment) string {
+	for _, candidate := range reSensorSerial.FindAllString(strings.ToUpper(t.Notes), -1) {
+		if strings.ContainsAny(candidate, "0123456789") && strings.ContainsAny(candidate, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") {
+			return candidate
+		}
+	}
+	return ""
+}
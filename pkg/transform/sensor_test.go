@@ -0,0 +1,55 @@
+package transform
+
+import (
+	"testing"
+
+	"github.com/blutz1982/go-nsexporter-libreview/pkg/nightscout"
+)
+
+func TestIsSensorStart(t *testing.T) {
+
+	tests := []struct {
+		eventType string
+		want      bool
+	}{
+		{eventType: nightscout.EventTypeSensorStart, want: true},
+		{eventType: nightscout.EventTypeSensorChange, want: true},
+		{eventType: "Sensor Stop"},
+		{eventType: nightscout.EventTypeNote},
+	}
+
+	for _, tt := range tests {
+		if got := IsSensorStart(&nightscout.Treatment{EventType: tt.eventType}); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.eventType, got, tt.want)
+		}
+	}
+}
+
+func TestSensorSerial(t *testing.T) {
+
+	tests := []struct {
+		name  string
+		notes string
+		want  string
+	}{
+		{name: "serial", notes: "0M0008B8CTR", want: "0M0008B8CTR"},
+		{name: "serial in text", notes: "new sensor SN: 0M0008B8CTR left arm", want: "0M0008B8CTR"},
+		{name: "lower case", notes: "sn 0m0008b8ctr", want: "0M0008B8CTR"},
+		{name: "10 characters", notes: "3MH00ABCDE", want: "3MH00ABCDE"},
+		{name: "no notes"},
+		{name: "no serial", notes: "left arm"},
+		{name: "only digits", notes: "lot 12345678901"},
+		{name: "only letters", notes: "SENSORSTART"},
+		{name: "other numbers", notes: "bg 120, 2 units, lot 20240310"},
+		{name: "too long", notes: "0M0008B8CTR12"},
+		{name: "the first serial", notes: "12345678901 0M0008B8CTR 0M0008B8CTS", want: "0M0008B8CTR"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SensorSerial(&nightscout.Treatment{Notes: tt.notes}); got != tt.want {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
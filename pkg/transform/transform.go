@@ -1,26 +1,27 @@
 package transform
 
 import (
-	"math/rand"
+	"strconv"
 	"time"
 
 	"github.com/blutz1982/go-nsexporter-libreview/pkg/libreview"
 	"github.com/blutz1982/go-nsexporter-libreview/pkg/nightscout"
 )
 
-func LibreUnscheduledContinuousGlucoseEntryToSensorStart(e *libreview.UnscheduledContinuousGlucoseEntry) *libreview.GenericEntry {
+// LibreSensorStartEntry returns sensorstart generic entry for the sensor inserted at startedAt
+func LibreSensorStartEntry(startedAt time.Time, profile libreview.SensorProfile) *libreview.GenericEntry {
 	return &libreview.GenericEntry{
-		Type: "com.abbottdiabetescare.informatics.sensorstart",
-		ExtendedProperties: libreview.GenericExtendedProperties{
-			FactoryTimestamp: e.ExtendedProperties.FactoryTimestamp,
-			Gmin:             "40",
-			Gmax:             "500",
-			WearDuration:     "20160",
-			WarmupTime:       "60",
-			ProductType:      "2",
+		Type: libreview.GenericTypeSensorStart,
+		ExtendedProperties: libreview.SensorStartExtendedProperties{
+			FactoryTimestamp: startedAt.UTC(),
+			Gmin:             strconv.Itoa(profile.Gmin),
+			Gmax:             strconv.Itoa(profile.Gmax),
+			WearDuration:     strconv.Itoa(profile.WearDuration),
+			WarmupTime:       strconv.Itoa(profile.WarmupTime),
+			ProductType:      strconv.Itoa(profile.ProductType),
 		},
-		RecordNumber: libreview.RecordNumberIncrementGeneric + e.Timestamp.Unix(),
-		Timestamp:    e.Timestamp,
+		RecordNumber: libreview.GenericRecordNumber(libreview.GenericTypeSensorStart, startedAt),
+		Timestamp:    startedAt.Local(),
 	}
 }
 
@@ -40,8 +41,8 @@ func NSToLibreScheduledGlucoseEntry(e *nightscout.GlucoseEntry) *libreview.Sched
 	}
 }
 
-func NSToLibreUnscheduledGlucoseEntry(e *nightscout.GlucoseEntry) *libreview.UnscheduledContinuousGlucoseEntry {
-	var duration = time.Minute * time.Duration(rand.Intn(3))
+// NSToLibreUnscheduledGlucoseEntry returns scan of the reading. The scan is jitter after the reading
+func NSToLibreUnscheduledGlucoseEntry(e *nightscout.GlucoseEntry, jitter time.Duration) *libreview.UnscheduledContinuousGlucoseEntry {
 	return &libreview.UnscheduledContinuousGlucoseEntry{
 		ValueInMgPerDl: e.Sgv.Float64(),
 		ExtendedProperties: libreview.UnscheduledExtendedProperties{
@@ -53,7 +54,7 @@ func NSToLibreUnscheduledGlucoseEntry(e *nightscout.GlucoseEntry) *libreview.Uns
 			IsActionable:           true,
 		},
 		RecordNumber: libreview.RecordNumberIncrementUnscheduled + e.Date.Time().Unix(),
-		Timestamp:    e.Date.Time().Local().Add(duration),
+		Timestamp:    e.Date.Time().Local().Add(jitter),
 	}
 }
 
@@ -62,28 +63,116 @@ var LongActingInsulinMap = map[bool]string{
 	false: "RapidActing",
 }
 
-func NSToLibreInsulinEntry(t *nightscout.Treatment) *libreview.InsulinEntry {
+// NSToLibreInsulinEntries returns one insulin entry per injection of the treatment
+// (or one RapidActing entry of treatment insulin without injections).
+// The only injection without units (free text) gets the units of treatment insulin.
+// Insulin type is classified by the catalog, mixed insulins are exported as RapidActing.
+// Injections after libreview.MaxInsulinInjections are dropped
+func NSToLibreInsulinEntries(t *nightscout.Treatment, catalog *nightscout.InsulinCatalog) (result libreview.InsulinEntries) {
 
+	if len(t.InsulinInjections) == 0 {
+		result.Append(newLibreInsulinEntry(t.ID, t.CreatedAt, 0, t.Insulin, false))
+		return
+	}
+
+	for i, injection := range t.InsulinInjections {
+		if i >= libreview.MaxInsulinInjections {
+			break
+		}
+		units := injection.Units
+		if units <= 0 && len(t.InsulinInjections) == 1 {
+			units = t.Insulin
+		}
+		if units <= 0 {
+			continue
+		}
+		insulin, ok := catalog.Find(injection.Insulin)
+		result.Append(newLibreInsulinEntry(t.ID, t.CreatedAt, i, units, ok && insulin.IsLongActing()))
+	}
+
+	return
+}
+
+func newLibreInsulinEntry(id string, ts time.Time, index int, units float64, longActing bool) *libreview.InsulinEntry {
 	return &libreview.InsulinEntry{
 		ExtendedProperties: libreview.TreatmentExtendedProperties{
-			FactoryTimestamp: t.CreatedAt,
+			FactoryTimestamp: ts,
 		},
-		RecordNumber: libreview.RecordNumberIncrementInsulin + t.CreatedAt.Unix(),
-		Timestamp:    t.CreatedAt.Local(),
-		Units:        t.Insulin,
-		InsulinType:  LongActingInsulinMap[t.InsulinInjections.IsLongActing()],
+		RecordNumber: libreview.InsulinRecordNumber(index, ts),
+		Timestamp:    ts.Local(),
+		Units:        units,
+		InsulinType:  LongActingInsulinMap[longActing],
+		SourceID:     id,
 	}
 }
 
-func NSToLibreFoodEntry(e *nightscout.Treatment) *libreview.FoodEntry {
-	return &libreview.FoodEntry{
-		ExtendedProperties: libreview.TreatmentExtendedProperties{
-			FactoryTimestamp: e.CreatedAt,
+func NSToLibreBloodGlucoseEntry(e *nightscout.GlucoseEntry) *libreview.BloodGlucoseEntry {
+	return newLibreBloodGlucoseEntry(e.Mbg, e.Date.Time())
+}
+
+func NSTreatmentToLibreBloodGlucoseEntry(t *nightscout.Treatment) *libreview.BloodGlucoseEntry {
+	return newLibreBloodGlucoseEntry(t.GlucoseMgPerDl(), t.CreatedAt)
+}
+
+func newLibreBloodGlucoseEntry(value nightscout.SVG, ts time.Time) *libreview.BloodGlucoseEntry {
+	return &libreview.BloodGlucoseEntry{
+		ValueInMgPerDl: value.Float64(),
+		ExtendedProperties: libreview.BloodGlucoseExtendedProperties{
+			FactoryTimestamp:       ts.UTC(),
+			LowOutOfRange:          value.LowOutOfRange(nightscout.DefaultMinSVG),
+			HighOutOfRange:         value.HighOutOfRange(nightscout.DefaultMaxSVG),
+			IsFirstAfterTimeChange: false,
+			CanMerge:               "true",
 		},
-		RecordNumber: libreview.RecordNumberIncrementFood + e.CreatedAt.Unix(),
-		Timestamp:    e.CreatedAt.Local(),
-		GramsCarbs:   int(e.Carbs),
-		FoodType:     "Unknown",
+		RecordNumber: libreview.RecordNumberIncrementBloodGlucose + ts.Unix(),
+		Timestamp:    ts.Local(),
+	}
+}
+
+const (
+	// enteredBy / device of entries created from LibreView data
+	NSEnteredBy = "nsexport"
+)
+
+func LibreScheduledGlucoseToNSEntry(e *libreview.ScheduledContinuousGlucoseEntry) *nightscout.GlucoseEntry {
+	date := nightscout.NSTime(e.Timestamp)
+	return &nightscout.GlucoseEntry{
+		Type:       nightscout.Sgv,
+		Device:     NSEnteredBy,
+		Date:       &date,
+		DateString: e.Timestamp.UTC(),
+		Sgv:        nightscout.SVG(e.ValueInMgPerDl),
+		Direction:  "NONE",
+	}
+}
+
+func LibreUnscheduledGlucoseToNSEntry(e *libreview.UnscheduledContinuousGlucoseEntry) *nightscout.GlucoseEntry {
+	date := nightscout.NSTime(e.Timestamp)
+	return &nightscout.GlucoseEntry{
+		Type:       nightscout.Sgv,
+		Device:     NSEnteredBy,
+		Date:       &date,
+		DateString: e.Timestamp.UTC(),
+		Sgv:        nightscout.SVG(e.ValueInMgPerDl),
+		Direction:  ToNSDirection(e.ExtendedProperties.TrendArrow),
+	}
+}
+
+// ToNSDirection is inverse for ToLibreDirection
+func ToNSDirection(libreTrendArrow string) string {
+	switch libreTrendArrow {
+	case "Stable":
+		return "Flat"
+	case "Falling":
+		return "SingleDown"
+	case "FallingQuickly":
+		return "DoubleDown"
+	case "Rising":
+		return "SingleUp"
+	case "RisingQuickly":
+		return "DoubleUp"
+	default:
+		return "NONE"
 	}
 }
 
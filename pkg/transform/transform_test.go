@@ -0,0 +1,85 @@
+package transform
+
+import (
+	"testing"
+	"time"
+
+	"github.com/blutz1982/go-nsexporter-libreview/pkg/libreview"
+	"github.com/blutz1982/go-nsexporter-libreview/pkg/nightscout"
+)
+
+func TestNSToLibreInsulinEntries(t *testing.T) {
+
+	catalog, err := nightscout.NewInsulinCatalog(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type entry struct {
+		units       float64
+		insulinType string
+	}
+
+	manyInjections := make(nightscout.InsulinInjections, libreview.MaxInsulinInjections+2)
+	for i := range manyInjections {
+		manyInjections[i] = nightscout.InsulinInjection{Insulin: "Fiasp", Units: 1}
+	}
+
+	tests := []struct {
+		name       string
+		insulin    float64
+		injections nightscout.InsulinInjections
+		want       []entry
+	}{
+		{name: "no injections", insulin: 3, want: []entry{{3, "RapidActing"}}},
+		{
+			name:       "injections",
+			insulin:    14,
+			injections: nightscout.InsulinInjections{{Insulin: "Tresiba", Units: 10}, {Insulin: "Fiasp", Units: 4}},
+			want:       []entry{{10, "LongActing"}, {4, "RapidActing"}},
+		},
+		{name: "free text", insulin: 10, injections: nightscout.InsulinInjections{{Insulin: "Lantus 10u"}}, want: []entry{{10, "LongActing"}}},
+		{name: "free text unknown insulin", insulin: 2, injections: nightscout.InsulinInjections{{Insulin: "pen"}}, want: []entry{{2, "RapidActing"}}},
+		{name: "mixed", injections: nightscout.InsulinInjections{{Insulin: "NovoMix", Units: 8}}, want: []entry{{8, "RapidActing"}}},
+		{
+			name:       "injection without units",
+			insulin:    4,
+			injections: nightscout.InsulinInjections{{Insulin: "Lantus"}, {Insulin: "Fiasp", Units: 4}},
+			want:       []entry{{4, "RapidActing"}},
+		},
+		{name: "too many injections", injections: manyInjections, want: make([]entry, libreview.MaxInsulinInjections)},
+	}
+
+	ts := time.Date(2024, 3, 10, 8, 0, 0, 0, time.UTC)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NSToLibreInsulinEntries(&nightscout.Treatment{
+				ID:                "t1",
+				CreatedAt:         ts,
+				Insulin:           tt.insulin,
+				InsulinInjections: tt.injections,
+			}, catalog)
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d entries, want %d", len(got), len(tt.want))
+			}
+
+			records := make(map[int64]struct{})
+			for i, e := range got {
+				if _, ok := records[e.RecordNumber]; ok {
+					t.Errorf("entry %d: duplicate record number %d", i, e.RecordNumber)
+				}
+				records[e.RecordNumber] = struct{}{}
+
+				// zero want entries only check the count and record numbers
+				if tt.want[i] == (entry{}) {
+					continue
+				}
+				if e.Units != tt.want[i].units || e.InsulinType != tt.want[i].insulinType {
+					t.Errorf("entry %d: got %v %s, want %v %s", i, e.Units, e.InsulinType, tt.want[i].units, tt.want[i].insulinType)
+				}
+			}
+		})
+	}
+}